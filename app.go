@@ -7,14 +7,37 @@ import (
 	"net/http"
 	"os"
 	"strconv"
+	"strings"
 	"sync"
+	"time"
 )
 
 type metadataMapper struct {
 	sync.RWMutex
-	mappings map[string]term
-	config   *notifierConfig
-	client   *http.Client
+	mappings       map[string]term
+	mappingVersion string
+	config         *notifierConfig
+	client         *http.Client
+	queue          *notificationQueue
+	outbox         *outbox
+	breaker        *circuitBreaker
+	deadLetters    *deadLetterStore
+	sent           *sentStore
+	sequencer      *videoSequencer
+	debouncer      *debouncer
+	audit          *auditLog
+	unmapped       *unmappedTagStore
+	hits           *mappingHits
+	format         metadataFormatter
+	concordances   *concordanceResolver
+	concepts       *conceptClient
+	hierarchy      hierarchy
+	overrides      *overrideStore
+	ignore         *tagFilter
+	ignoredTags    *ignoredTagCounter
+	gazetteer      *gazetteer
+	names          *nameNormaliser
+	suggested      suggestionCache
 }
 
 type notifierConfig struct {
@@ -23,11 +46,56 @@ type notifierConfig struct {
 	cmsMetadataNotifierHost string
 	cmsMetadataNotifierAuth string
 	port                    int
+	asyncMode               bool
+	workers                 int
+	queueSize               int
+	outboxPath              string
+	maxRetries              int
+	retryInitialBackoff     time.Duration
+	retryMaxBackoff         time.Duration
+	breakerThreshold        int
+	breakerProbeInterval    time.Duration
+	deadLetterDir           string
+	deadLetterLimit         int
+	dedupeTTL               time.Duration
+	dedupePath              string
+	debounceWindow          time.Duration
+	auditLogPath            string
+	unmappedTagsLimit       int
+	mappingHitsPath         string
+	unusedMappingWindow     time.Duration
+	suggestionsCount        int
+	suggestionMinScore      float64
+	autoApplySuggestions    bool
+	autoApplyMinScore       float64
+	outputFormat            string
+	xmlTagPredicates        bool
+	defaultPredicates       map[string]string
+	concordanceURL          string
+	concordanceTTL          time.Duration
+	conceptIDs              string
+	onConcordanceError      string
+	conceptLookupURL        string
+	followMergedConcepts    bool
+	conceptCacheTTL         time.Duration
+	enrichLabels            bool
+	hierarchyURL            string
+	hierarchyFromConcepts   bool
+	hierarchyMaxDepth       int
+	expansionScore          int
+	overridesPath           string
+	ignoreTags              []string
+	namespaceTaxonomies     map[string]string
+	fieldMappings           []fieldMapping
+	gazetteerPath           string
+	personNamespaces        []string
+	personTaxonomies        []string
 }
 
 type healthcheck struct {
-	config *notifierConfig
-	client *http.Client
+	config  *notifierConfig
+	client  *http.Client
+	breaker *circuitBreaker
 }
 
 func main() {
@@ -62,29 +130,457 @@ func main() {
 		Desc:   "Listening port of this service",
 		EnvVar: "PORT",
 	})
+	asyncMode := cliApp.Bool(cli.BoolOpt{
+		Name:   "async-mode",
+		Value:  false,
+		Desc:   "Accept notifications with 202 and deliver them from an in-process queue",
+		EnvVar: "ASYNC_MODE",
+	})
+	workers := cliApp.Int(cli.IntOpt{
+		Name:   "workers",
+		Value:  4,
+		Desc:   "Number of workers draining the notification queue in async mode",
+		EnvVar: "WORKERS",
+	})
+	queueSize := cliApp.Int(cli.IntOpt{
+		Name:   "queue-size",
+		Value:  100,
+		Desc:   "Capacity of the notification queue in async mode",
+		EnvVar: "QUEUE_SIZE",
+	})
+	outboxPath := cliApp.String(cli.StringOpt{
+		Name:   "outbox-path",
+		Value:  "",
+		Desc:   "File persisting accepted notifications until they are delivered, in async mode. Empty disables it",
+		EnvVar: "OUTBOX_PATH",
+	})
+	maxRetries := cliApp.Int(cli.IntOpt{
+		Name:   "max-retries",
+		Value:  3,
+		Desc:   "Retries of a failed send to cms-metadata-notifier (network errors, 5xx and 429 only)",
+		EnvVar: "MAX_RETRIES",
+	})
+	retryInitialBackoff := cliApp.Int(cli.IntOpt{
+		Name:   "retry-initial-backoff-ms",
+		Value:  200,
+		Desc:   "Delay before the first retry in milliseconds, doubled on each following retry",
+		EnvVar: "RETRY_INITIAL_BACKOFF_MS",
+	})
+	retryMaxBackoff := cliApp.Int(cli.IntOpt{
+		Name:   "retry-max-backoff-ms",
+		Value:  5000,
+		Desc:   "Upper bound of the delay between retries in milliseconds",
+		EnvVar: "RETRY_MAX_BACKOFF_MS",
+	})
+	breakerThreshold := cliApp.Int(cli.IntOpt{
+		Name:   "breaker-failure-threshold",
+		Value:  5,
+		Desc:   "Consecutive failed sends to cms-metadata-notifier which open the circuit breaker. 0 disables the breaker",
+		EnvVar: "BREAKER_FAILURE_THRESHOLD",
+	})
+	breakerProbeInterval := cliApp.Int(cli.IntOpt{
+		Name:   "breaker-probe-interval-ms",
+		Value:  30000,
+		Desc:   "Time the circuit breaker stays open before letting a probe request through, in milliseconds",
+		EnvVar: "BREAKER_PROBE_INTERVAL_MS",
+	})
+	deadLetterDir := cliApp.String(cli.StringOpt{
+		Name:   "dead-letter-dir",
+		Value:  "",
+		Desc:   "Directory persisting the notifications which failed delivery. Empty keeps them in memory only",
+		EnvVar: "DEAD_LETTER_DIR",
+	})
+	deadLetterLimit := cliApp.Int(cli.IntOpt{
+		Name:   "dead-letter-limit",
+		Value:  1000,
+		Desc:   "Maximum number of dead letters kept, the oldest ones are dropped beyond it. 0 means no limit",
+		EnvVar: "DEAD_LETTER_LIMIT",
+	})
+	dedupeTTL := cliApp.Int(cli.IntOpt{
+		Name:   "dedupe-ttl-hours",
+		Value:  0,
+		Desc:   "How long the hash of the last metadata sent for a video is kept to skip unchanged sends. 0 (default) disables the check",
+		EnvVar: "DEDUPE_TTL_HOURS",
+	})
+	dedupePath := cliApp.String(cli.StringOpt{
+		Name:   "dedupe-path",
+		Value:  "",
+		Desc:   "File persisting the hashes of the metadata sent. Empty keeps them in memory only",
+		EnvVar: "DEDUPE_PATH",
+	})
+	debounceWindow := cliApp.Int(cli.IntOpt{
+		Name:   "debounce-window-ms",
+		Value:  0,
+		Desc:   "Window collapsing the notifications of a video into a single send of the latest one, in async mode. 0 disables it",
+		EnvVar: "DEBOUNCE_WINDOW_MS",
+	})
+	auditLogPath := cliApp.String(cli.StringOpt{
+		Name:   "audit-log-path",
+		Value:  "",
+		Desc:   "File recording the annotations generated for each video with their provenance. Empty disables it",
+		EnvVar: "AUDIT_LOG_PATH",
+	})
+	unmappedTagsLimit := cliApp.Int(cli.IntOpt{
+		Name:   "unmapped-tags-limit",
+		Value:  5000,
+		Desc:   "Maximum number of distinct unmapped tags counted for /__unmapped",
+		EnvVar: "UNMAPPED_TAGS_LIMIT",
+	})
+	mappingHitsPath := cliApp.String(cli.StringOpt{
+		Name:   "mapping-hits-path",
+		Value:  "",
+		Desc:   "File persisting how often each mapping matched a tag. Empty keeps the counts in memory only",
+		EnvVar: "MAPPING_HITS_PATH",
+	})
+	unusedMappingDays := cliApp.Int(cli.IntOpt{
+		Name:   "unused-mapping-days",
+		Value:  30,
+		Desc:   "Default window of /__mappings/unused: mappings without hits in this many days are reported",
+		EnvVar: "UNUSED_MAPPING_DAYS",
+	})
+	suggestionsCount := cliApp.Int(cli.IntOpt{
+		Name:   "suggestions-count",
+		Value:  3,
+		Desc:   "Number of closest mappings suggested for an unmapped tag in /__unmapped and dry-run responses. 0 disables suggestions",
+		EnvVar: "SUGGESTIONS_COUNT",
+	})
+	suggestionMinScore := cliApp.Int(cli.IntOpt{
+		Name:   "suggestion-min-score",
+		Value:  60,
+		Desc:   "Minimum similarity, in percent, of a suggested mapping",
+		EnvVar: "SUGGESTION_MIN_SCORE",
+	})
+	autoApplySuggestions := cliApp.Bool(cli.BoolOpt{
+		Name:   "auto-apply-suggestions",
+		Value:  false,
+		Desc:   "Map an unmapped tag through its best suggestion when it scores at least auto-apply-min-score",
+		EnvVar: "AUTO_APPLY_SUGGESTIONS",
+	})
+	autoApplyMinScore := cliApp.Int(cli.IntOpt{
+		Name:   "auto-apply-min-score",
+		Value:  95,
+		Desc:   "Minimum similarity, in percent, of a suggestion applied automatically",
+		EnvVar: "AUTO_APPLY_MIN_SCORE",
+	})
+	outputFormat := cliApp.String(cli.StringOpt{
+		Name:   "output-format",
+		Value:  formatXML,
+		Desc:   "Format of the metadata sent to cms-metadata-notifier: xml (legacy base64 contentRef) or json (UPP annotations)",
+		EnvVar: "OUTPUT_FORMAT",
+	})
+	xmlTagPredicates := cliApp.Bool(cli.BoolOpt{
+		Name:   "xml-tag-predicates",
+		Value:  false,
+		Desc:   "Add the predicate of each term as an attribute of its tag in the contentRef XML",
+		EnvVar: "XML_TAG_PREDICATES",
+	})
+	defaultPredicates := cliApp.String(cli.StringOpt{
+		Name:   "default-predicates",
+		Value:  "",
+		Desc:   "Predicate of the mappings without one, per taxonomy, e.g. Sections=isClassifiedBy,Authors=hasAuthor. Unlisted taxonomies default to isClassifiedBy for classifications and mentions otherwise",
+		EnvVar: "DEFAULT_PREDICATES",
+	})
+
+	concordanceURL := cliApp.String(cli.StringOpt{
+		Name:   "concordance-url",
+		Value:  "",
+		Desc:   "URL of the UPP concordances API resolving TME IDs to concept UUIDs, e.g. http://localhost:8080/concordances. No concordance when empty",
+		EnvVar: "CONCORDANCE_URL",
+	})
+	concordanceTTL := cliApp.Int(cli.IntOpt{
+		Name:   "concordance-ttl-minutes",
+		Value:  60,
+		Desc:   "How long the resolved concordances, including the missing ones, are cached",
+		EnvVar: "CONCORDANCE_TTL_MINUTES",
+	})
+	conceptIDs := cliApp.String(cli.StringOpt{
+		Name:   "concept-ids",
+		Value:  conceptIDsAlongside,
+		Desc:   "Whether the resolved concept UUIDs are sent alongside or instead of the TME IDs",
+		EnvVar: "CONCEPT_IDS",
+	})
+	onConcordanceError := cliApp.String(cli.StringOpt{
+		Name:   "on-concordance-error",
+		Value:  onConcordanceErrorFallback,
+		Desc:   "What to do when a concordance lookup fails: fallback (send the TME ID only) or fail (reject the notification)",
+		EnvVar: "ON_CONCORDANCE_ERROR",
+	})
+
+	conceptLookupURL := cliApp.String(cli.StringOpt{
+		Name:   "concept-lookup-url",
+		Value:  "",
+		Desc:   "URL of the concept lookup service validating the mapped TME IDs at reload, queried with GET {url}/{tmeID}. No validation when empty",
+		EnvVar: "CONCEPT_LOOKUP_URL",
+	})
+	followMergedConcepts := cliApp.Bool(cli.BoolOpt{
+		Name:   "follow-merged-concepts",
+		Value:  false,
+		Desc:   "Whether mappings to merged concepts are redirected to the concept they were merged into",
+		EnvVar: "FOLLOW_MERGED_CONCEPTS",
+	})
+
+	conceptCacheTTL := cliApp.Int(cli.IntOpt{
+		Name:   "concept-cache-ttl-minutes",
+		Value:  60,
+		Desc:   "How long the concepts looked up at reload are cached",
+		EnvVar: "CONCEPT_CACHE_TTL_MINUTES",
+	})
+	enrichLabels := cliApp.Bool(cli.BoolOpt{
+		Name:   "enrich-labels",
+		Value:  false,
+		Desc:   "Whether the canonical names of the mappings are replaced by the preferred labels from the concept lookup service",
+		EnvVar: "ENRICH_LABELS",
+	})
+
+	hierarchyURL := cliApp.String(cli.StringOpt{
+		Name:   "hierarchy-url",
+		Value:  "",
+		Desc:   "URL or local path of the hierarchy sheet giving the broader concepts of the mapped ones. No hierarchy when empty",
+		EnvVar: "HIERARCHY_URL",
+	})
+	hierarchyFromConcepts := cliApp.Bool(cli.BoolOpt{
+		Name:   "hierarchy-from-concepts",
+		Value:  false,
+		Desc:   "Whether the broader concepts are also taken from the concept lookup service",
+		EnvVar: "HIERARCHY_FROM_CONCEPTS",
+	})
+	hierarchyMaxDepth := cliApp.Int(cli.IntOpt{
+		Name:   "hierarchy-max-depth",
+		Value:  2,
+		Desc:   "How many levels of broader concepts are added to the annotations",
+		EnvVar: "HIERARCHY_MAX_DEPTH",
+	})
+	expansionScore := cliApp.Int(cli.IntOpt{
+		Name:   "expansion-score",
+		Value:  50,
+		Desc:   "Confidence and relevance, in percent, of the broader concepts added to the annotations",
+		EnvVar: "EXPANSION_SCORE",
+	})
+
+	overridesPath := cliApp.String(cli.StringOpt{
+		Name:   "overrides-path",
+		Value:  "",
+		Desc:   "File keeping the per video annotation overrides. Kept in memory only when empty",
+		EnvVar: "OVERRIDES_PATH",
+	})
+
+	ignoreTags := cliApp.String(cli.StringOpt{
+		Name:   "ignore-tags",
+		Value:  "",
+		Desc:   "JSON list of the Brightcove tags left out of the mapping: exact values, prefixes ending with * or /regular expressions/, e.g. [\"ft:noads\",\"player:*\"]",
+		EnvVar: "IGNORE_TAGS",
+	})
+	ignoreTagsPath := cliApp.String(cli.StringOpt{
+		Name:   "ignore-tags-path",
+		Value:  "",
+		Desc:   "File with more ignored tags rules, one per line",
+		EnvVar: "IGNORE_TAGS_PATH",
+	})
+
+	namespaceTaxonomies := cliApp.String(cli.StringOpt{
+		Name:   "namespace-taxonomies",
+		Value:  "",
+		Desc:   "Taxonomy expected for the tags of each namespace, e.g. section=Sections,author=Authors. Mappings contradicting it are reported at reload",
+		EnvVar: "NAMESPACE_TAXONOMIES",
+	})
+
+	customFieldMappings := cliApp.String(cli.StringOpt{
+		Name:   "custom-field-mappings",
+		Value:  "",
+		Desc:   "Brightcove custom fields mapped like tags of a namespace, with an optional predicate, e.g. primarySection=section/isPrimarilyClassifiedBy,brand=brand,byline=author",
+		EnvVar: "CUSTOM_FIELD_MAPPINGS",
+	})
+
+	gazetteerPath := cliApp.String(cli.StringOpt{
+		Name:   "gazetteer-path",
+		Value:  "",
+		Desc:   "JSON file giving the Regions TME ID of each ISO country code, e.g. {\"GB\":\"...\"}, for country tags without mapping. No gazetteer when empty",
+		EnvVar: "GAZETTEER_PATH",
+	})
+
+	personNamespaces := cliApp.String(cli.StringOpt{
+		Name:   "person-namespaces",
+		Value:  "author,person,people,byline",
+		Desc:   "Namespaces of the tags naming persons, matched whatever the form of the name",
+		EnvVar: "PERSON_NAMESPACES",
+	})
+	personTaxonomies := cliApp.String(cli.StringOpt{
+		Name:   "person-taxonomies",
+		Value:  "Authors,People",
+		Desc:   "Taxonomies of the mappings naming persons, matched whatever the form of the name",
+		EnvVar: "PERSON_TAXONOMIES",
+	})
 
 	cliApp.Action = func() {
 		initLogs(os.Stdout, os.Stdout, os.Stderr)
 		if *mappingURL == "" {
 			errorLogger.Panic("Please provide a valid URL")
 		}
+		predicates, err := parseDefaultPredicates(*defaultPredicates)
+		if err != nil {
+			errorLogger.Panic(err)
+		}
+		if *onConcordanceError != onConcordanceErrorFallback && *onConcordanceError != onConcordanceErrorFail {
+			errorLogger.Panicf("Unknown on-concordance-error: [%s]", *onConcordanceError)
+		}
+		ignoreRules, err := readIgnoreRules(*ignoreTags, *ignoreTagsPath)
+		if err != nil {
+			errorLogger.Panic(err)
+		}
+		expectedTaxonomies, err := parseNamespaceTaxonomies(*namespaceTaxonomies)
+		if err != nil {
+			errorLogger.Panic(err)
+		}
+		fields, err := parseFieldMappings(*customFieldMappings)
+		if err != nil {
+			errorLogger.Panic(err)
+		}
 		nConfig := &notifierConfig{
 			mappingURL:              *mappingURL,
 			cmsMetadataNotifierAddr: *cmsMetadataNotifierAddr,
 			cmsMetadataNotifierHost: *cmsMetadataNotifierHost,
 			cmsMetadataNotifierAuth: *cmsMetadataNotifierAuth,
-			port: *port,
+			port:                    *port,
+			asyncMode:               *asyncMode,
+			workers:                 *workers,
+			queueSize:               *queueSize,
+			outboxPath:              *outboxPath,
+			maxRetries:              *maxRetries,
+			retryInitialBackoff:     time.Duration(*retryInitialBackoff) * time.Millisecond,
+			retryMaxBackoff:         time.Duration(*retryMaxBackoff) * time.Millisecond,
+			breakerThreshold:        *breakerThreshold,
+			breakerProbeInterval:    time.Duration(*breakerProbeInterval) * time.Millisecond,
+			deadLetterDir:           *deadLetterDir,
+			deadLetterLimit:         *deadLetterLimit,
+			dedupeTTL:               time.Duration(*dedupeTTL) * time.Hour,
+			dedupePath:              *dedupePath,
+			debounceWindow:          time.Duration(*debounceWindow) * time.Millisecond,
+			auditLogPath:            *auditLogPath,
+			unmappedTagsLimit:       *unmappedTagsLimit,
+			mappingHitsPath:         *mappingHitsPath,
+			unusedMappingWindow:     time.Duration(*unusedMappingDays) * 24 * time.Hour,
+			suggestionsCount:        *suggestionsCount,
+			suggestionMinScore:      float64(*suggestionMinScore) / 100,
+			autoApplySuggestions:    *autoApplySuggestions,
+			autoApplyMinScore:       float64(*autoApplyMinScore) / 100,
+			outputFormat:            *outputFormat,
+			xmlTagPredicates:        *xmlTagPredicates,
+			defaultPredicates:       predicates,
+			concordanceURL:          *concordanceURL,
+			concordanceTTL:          time.Duration(*concordanceTTL) * time.Minute,
+			conceptIDs:              *conceptIDs,
+			onConcordanceError:      *onConcordanceError,
+			conceptLookupURL:        *conceptLookupURL,
+			followMergedConcepts:    *followMergedConcepts,
+			conceptCacheTTL:         time.Duration(*conceptCacheTTL) * time.Minute,
+			enrichLabels:            *enrichLabels,
+			hierarchyURL:            *hierarchyURL,
+			hierarchyFromConcepts:   *hierarchyFromConcepts,
+			hierarchyMaxDepth:       *hierarchyMaxDepth,
+			expansionScore:          *expansionScore,
+			overridesPath:           *overridesPath,
+			ignoreTags:              trimAll(ignoreRules),
+			namespaceTaxonomies:     expectedTaxonomies,
+			fieldMappings:           fields,
+			gazetteerPath:           *gazetteerPath,
+			personNamespaces:        trimAll(strings.Split(*personNamespaces, ",")),
+			personTaxonomies:        trimAll(strings.Split(*personTaxonomies, ",")),
 		}
 		infoLogger.Printf("%v", nConfig.prettyPrint())
 		httpClient := &http.Client{}
 
 		mapper := metadataMapper{
-			config: nConfig,
-			client: httpClient,
+			config:    nConfig,
+			client:    httpClient,
+			sequencer: newVideoSequencer(),
+			unmapped:  newUnmappedTagStore(nConfig.unmappedTagsLimit),
+		}
+		ignore, err := newTagFilter(nConfig.ignoreTags)
+		if err != nil {
+			errorLogger.Panic(err)
+		}
+		if !ignore.empty() {
+			mapper.ignore = ignore
+		}
+		mapper.ignoredTags = newIgnoredTagCounter(nConfig.unmappedTagsLimit)
+		if len(nConfig.personNamespaces) > 0 || len(nConfig.personTaxonomies) > 0 {
+			mapper.names = newNameNormaliser(nConfig.personNamespaces, nConfig.personTaxonomies)
+		}
+		if nConfig.gazetteerPath != "" {
+			g, err := loadGazetteer(nConfig.gazetteerPath)
+			if err != nil {
+				errorLogger.Panic(err)
+			}
+			mapper.gazetteer = g
+		}
+		if nConfig.breakerThreshold > 0 {
+			mapper.breaker = newCircuitBreaker(nConfig.breakerThreshold, nConfig.breakerProbeInterval)
+		}
+		deadLetters, err := newDeadLetterStore(nConfig.deadLetterDir, nConfig.deadLetterLimit)
+		if err != nil {
+			errorLogger.Panicf("Couldn't open dead letter store: %v", err)
+		}
+		mapper.deadLetters = deadLetters
+		overrides, err := newOverrideStore(nConfig.overridesPath)
+		if err != nil {
+			errorLogger.Panicf("Couldn't open overrides: %v", err)
+		}
+		mapper.overrides = overrides
+		if nConfig.dedupeTTL > 0 {
+			sent, err := newSentStore(nConfig.dedupeTTL, nConfig.dedupePath)
+			if err != nil {
+				errorLogger.Panicf("Couldn't open dedupe store: %v", err)
+			}
+			mapper.sent = sent
+		}
+		if nConfig.auditLogPath != "" {
+			audit, err := openAuditLog(nConfig.auditLogPath)
+			if err != nil {
+				errorLogger.Panicf("Couldn't open audit log: %v", err)
+			}
+			mapper.audit = audit
+		}
+		hits, err := newMappingHits(nConfig.mappingHitsPath)
+		if err != nil {
+			errorLogger.Panicf("Couldn't load mapping hits: %v", err)
+		}
+		mapper.hits = hits
+		if nConfig.mappingHitsPath != "" {
+			go hits.saveEvery(time.Minute)
+		}
+		format, err := newFormatter(nConfig.outputFormat, nConfig.conceptIDs, nConfig.xmlTagPredicates)
+		if err != nil {
+			errorLogger.Panic(err)
+		}
+		mapper.format = format
+		if nConfig.concordanceURL != "" {
+			mapper.concordances = newConcordanceResolver(nConfig.concordanceURL, httpClient, nConfig.concordanceTTL)
+		}
+		if nConfig.conceptLookupURL != "" {
+			mapper.concepts = newConceptClient(nConfig.conceptLookupURL, httpClient, nConfig.conceptCacheTTL)
 		}
 		mapper.loadMappings()
+		if nConfig.asyncMode {
+			mapper.queue = newNotificationQueue(nConfig.queueSize)
+			if nConfig.outboxPath != "" {
+				ob, err := openOutbox(nConfig.outboxPath)
+				if err != nil {
+					errorLogger.Panicf("Couldn't open outbox: %v", err)
+				}
+				mapper.outbox = ob
+			}
+			if nConfig.debounceWindow > 0 {
+				mapper.debouncer = newDebouncer(nConfig.debounceWindow, mapper.queue.requeue)
+			}
+			mapper.startWorkers(nConfig.workers)
+			if mapper.outbox != nil {
+				go mapper.replayOutbox()
+			}
+		} else if nConfig.outboxPath != "" || nConfig.debounceWindow > 0 {
+			warnLogger.Println("Outbox path and debounce window are ignored, they are used in async mode only")
+		}
 
-		hc := healthcheck{config: nConfig, client: httpClient}
+		hc := healthcheck{config: nConfig, client: httpClient, breaker: mapper.breaker}
 
 		listen(&mapper, hc)
 	}
@@ -94,20 +590,78 @@ func main() {
 	}
 }
 
-func (mm *metadataMapper) loadMappings() {
+// reloadReport sums up a load of the mappings
+type reloadReport struct {
+	MappingVersion     string              `json:"mappingVersion"`
+	Mappings           int                 `json:"mappings"`
+	ConceptIssues      []conceptIssue      `json:"conceptIssues,omitempty"`
+	LabelsEnriched     int                 `json:"labelsEnriched,omitempty"`
+	BroaderConcepts    int                 `json:"broaderConcepts,omitempty"`
+	HierarchyCycles    []string            `json:"hierarchyCycles,omitempty"`
+	NamespaceConflicts []namespaceConflict `json:"namespaceConflicts,omitempty"`
+}
+
+// loadMappings fetches and validates the mappings before swapping them in, so that notifications aren't held meanwhile
+func (mm *metadataMapper) loadMappings() reloadReport {
+	mappings, version := fetchMappings(mm.config.mappingURL, mm.config.defaultPredicates)
+	if mm.names != nil {
+		var rekeyed int
+		mappings, rekeyed = mm.names.normaliseKeys(mappings)
+		infoLogger.Printf("Normalised the person names of [%d] mappings", rekeyed)
+	}
+	report := reloadReport{MappingVersion: version, Mappings: len(mappings)}
+	if len(mm.config.namespaceTaxonomies) > 0 {
+		report.NamespaceConflicts = checkNamespaces(mappings, mm.config.namespaceTaxonomies)
+		for _, c := range report.NamespaceConflicts {
+			warnLogger.Printf("Mapping [%s] at row [%d]: [%s] tags should map to [%s] concepts, not [%s]", c.Key, c.Row, c.Namespace, c.Expected, c.Taxonomy)
+		}
+	}
+	if mm.concepts != nil {
+		report.ConceptIssues = validateConcepts(mappings, mm.concepts, mm.config.followMergedConcepts)
+		for _, issue := range report.ConceptIssues {
+			warnLogger.Printf("Mapping [%s] at row [%d]: concept [%s] %s %s", issue.Key, issue.Row, issue.ID, issue.Problem, issue.MergedInto)
+		}
+		infoLogger.Printf("Validated the concepts of mappings version [%s]: [%d] issues", version, len(report.ConceptIssues))
+		if mm.config.enrichLabels {
+			report.LabelsEnriched = enrichLabels(mappings, mm.concepts)
+			infoLogger.Printf("Enriched [%d] labels of mappings version [%s]", report.LabelsEnriched, version)
+		}
+	}
+	h := mm.loadHierarchy(mappings)
+	for _, broader := range h {
+		report.BroaderConcepts += len(broader)
+	}
+	if report.HierarchyCycles = h.cycles(); len(report.HierarchyCycles) > 0 {
+		warnLogger.Printf("Concepts broader than themselves in the hierarchy: %v", report.HierarchyCycles)
+	}
+
 	mm.Lock()
 	defer mm.Unlock()
-
-	mm.mappings = fetchMappings(mm.config.mappingURL)
+	mm.mappings, mm.mappingVersion, mm.hierarchy = mappings, version, h
 	infoLogger.Printf("%v", mm.prettyPrintMappings())
+	return report
 }
 
 func listen(mm *metadataMapper, hc healthcheck) {
 	r := mux.NewRouter()
 	r.HandleFunc("/notify", mm.handleNotification).Methods("POST")
+	r.HandleFunc("/notify/{id}", mm.handleNotificationStatus).Methods("GET")
+	r.HandleFunc("/preview", mm.handlePreview).Methods("POST")
+	r.HandleFunc("/videos/{uuid}/overrides", mm.handleGetOverride).Methods("GET")
+	r.HandleFunc("/videos/{uuid}/overrides", mm.handlePutOverride).Methods("PUT")
+	r.HandleFunc("/videos/{uuid}/overrides", mm.handleDeleteOverride).Methods("DELETE")
 	r.HandleFunc("/__health", hc.health()).Methods("GET")
 	r.HandleFunc("/__gtg", hc.gtg).Methods("GET")
 	r.HandleFunc("/__reload", mm.handleReload).Methods("POST")
+	r.HandleFunc("/__unmapped", mm.handleUnmapped).Methods("GET")
+	r.HandleFunc("/__ignored", mm.handleIgnored).Methods("GET")
+	r.HandleFunc("/__mappings/unused", mm.handleUnusedMappings).Methods("GET")
+	r.HandleFunc("/__dead-letters", mm.handleListDeadLetters).Methods("GET")
+	r.HandleFunc("/__dead-letters", mm.handlePurgeDeadLetters).Methods("DELETE")
+	r.HandleFunc("/__dead-letters/replay", mm.handleReplayAllDeadLetters).Methods("POST")
+	r.HandleFunc("/__dead-letters/{id}", mm.handleGetDeadLetter).Methods("GET")
+	r.HandleFunc("/__dead-letters/{id}", mm.handleDeleteDeadLetter).Methods("DELETE")
+	r.HandleFunc("/__dead-letters/{id}/replay", mm.handleReplayDeadLetter).Methods("POST")
 
 	http.Handle("/", r)
 	infoLogger.Printf("Starting to listen on port [%d]", mm.config.port)
@@ -117,10 +671,25 @@ func listen(mm *metadataMapper, hc healthcheck) {
 	}
 }
 
+func (mm *metadataMapper) loadHierarchy(mappings map[string]term) hierarchy {
+	h := make(hierarchy)
+	if mm.config.hierarchyURL != "" {
+		loaded, err := loadHierarchy(mm.config.hierarchyURL)
+		if err != nil {
+			errorLogger.Panic(err)
+		}
+		h = loaded
+	}
+	if mm.config.hierarchyFromConcepts && mm.concepts != nil {
+		hierarchyFromConcepts(mappings, mm.concepts, mm.config.hierarchyMaxDepth, h)
+	}
+	return h
+}
+
 func (nc notifierConfig) prettyPrint() string {
 	authSet := "empty"
 	if nc.cmsMetadataNotifierAuth != "" {
 		authSet = "set, not empty"
 	}
-	return fmt.Sprintf("\n\t\tmappingURL: [%s]\n\t\tcmsMetadataNotifierAddr: [%s]\n\t\tcmsMetadataNotifierHost: [%s]\n\t\tport: [%d]\n\t\tcmsMetadataNotifierAuth: [%s]\n\t", nc.mappingURL, nc.cmsMetadataNotifierAddr, nc.cmsMetadataNotifierHost, nc.port, authSet)
+	return fmt.Sprintf("\n\t\tmappingURL: [%s]\n\t\tcmsMetadataNotifierAddr: [%s]\n\t\tcmsMetadataNotifierHost: [%s]\n\t\tport: [%d]\n\t\tcmsMetadataNotifierAuth: [%s]\n\t\tasyncMode: [%t]\n\t\tworkers: [%d]\n\t\tqueueSize: [%d]\n\t\toutboxPath: [%s]\n\t\tmaxRetries: [%d]\n\t\tretryInitialBackoff: [%v]\n\t\tretryMaxBackoff: [%v]\n\t\tbreakerThreshold: [%d]\n\t\tbreakerProbeInterval: [%v]\n\t\tdeadLetterDir: [%s]\n\t\tdeadLetterLimit: [%d]\n\t\tdedupeTTL: [%v]\n\t\tdedupePath: [%s]\n\t\tdebounceWindow: [%v]\n\t\tauditLogPath: [%s]\n\t\tunmappedTagsLimit: [%d]\n\t\tmappingHitsPath: [%s]\n\t\tunusedMappingWindow: [%v]\n\t\tsuggestionsCount: [%d]\n\t\tsuggestionMinScore: [%.2f]\n\t\tautoApplySuggestions: [%t]\n\t\tautoApplyMinScore: [%.2f]\n\t\toutputFormat: [%s]\n\t\txmlTagPredicates: [%t]\n\t\tdefaultPredicates: [%v]\n\t\tconcordanceURL: [%s]\n\t\tconcordanceTTL: [%v]\n\t\tconceptIDs: [%s]\n\t\tonConcordanceError: [%s]\n\t\tconceptLookupURL: [%s]\n\t\tfollowMergedConcepts: [%t]\n\t\tconceptCacheTTL: [%v]\n\t\tenrichLabels: [%t]\n\t\thierarchyURL: [%s]\n\t\thierarchyFromConcepts: [%t]\n\t\thierarchyMaxDepth: [%d]\n\t\texpansionScore: [%d]\n\t\toverridesPath: [%s]\n\t\tignoreTags: [%v]\n\t\tnamespaceTaxonomies: [%v]\n\t\tfieldMappings: [%+v]\n\t\tgazetteerPath: [%s]\n\t\tpersonNamespaces: [%v]\n\t\tpersonTaxonomies: [%v]\n\t", nc.mappingURL, nc.cmsMetadataNotifierAddr, nc.cmsMetadataNotifierHost, nc.port, authSet, nc.asyncMode, nc.workers, nc.queueSize, nc.outboxPath, nc.maxRetries, nc.retryInitialBackoff, nc.retryMaxBackoff, nc.breakerThreshold, nc.breakerProbeInterval, nc.deadLetterDir, nc.deadLetterLimit, nc.dedupeTTL, nc.dedupePath, nc.debounceWindow, nc.auditLogPath, nc.unmappedTagsLimit, nc.mappingHitsPath, nc.unusedMappingWindow, nc.suggestionsCount, nc.suggestionMinScore, nc.autoApplySuggestions, nc.autoApplyMinScore, nc.outputFormat, nc.xmlTagPredicates, nc.defaultPredicates, nc.concordanceURL, nc.concordanceTTL, nc.conceptIDs, nc.onConcordanceError, nc.conceptLookupURL, nc.followMergedConcepts, nc.conceptCacheTTL, nc.enrichLabels, nc.hierarchyURL, nc.hierarchyFromConcepts, nc.hierarchyMaxDepth, nc.expansionScore, nc.overridesPath, nc.ignoreTags, nc.namespaceTaxonomies, nc.fieldMappings, nc.gazetteerPath, nc.personNamespaces, nc.personTaxonomies)
 }
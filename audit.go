@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+type auditEntry struct {
+	Time         time.Time `json:"time"`
+	TID          string    `json:"tid"`
+	UUID         string    `json:"uuid"`
+	Terms        []term    `json:"terms"`
+	UnmappedTags []string  `json:"unmappedTags"`
+	IgnoredTags  []string  `json:"ignoredTags,omitempty"`
+}
+
+// auditLog appends the annotations generated for each video, with their provenance, to a JSON lines file
+type auditLog struct {
+	sync.Mutex
+	file *os.File
+}
+
+func openAuditLog(path string) (*auditLog, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("Opening audit log: [%v]", err)
+	}
+	return &auditLog{file: f}, nil
+}
+
+func (al *auditLog) record(entry auditEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("Marshalling audit entry: [%v]", err)
+	}
+	al.Lock()
+	defer al.Unlock()
+	if _, err = al.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("Writing audit log: [%v]", err)
+	}
+	return nil
+}
+
+func (mm *metadataMapper) recordAudit(uuid string, tid string, a annotations) {
+	if mm.audit == nil {
+		return
+	}
+	entry := auditEntry{Time: time.Now().UTC(), TID: tid, UUID: uuid, Terms: a.Terms, UnmappedTags: a.Unmapped, IgnoredTags: a.Ignored}
+	if err := mm.audit.record(entry); err != nil {
+		errorLogger.Printf("tid=[%s]. Auditing annotations of video=[%s]: %v", tid, uuid, err)
+	}
+}
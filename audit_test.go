@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestHandleNotification_AuditEntryWithSheetRowWritten(t *testing.T) {
+	sheet := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[{"brightcovesearchterm":"tag:section:world","streamurl":"/stream/sectionsId/MQ==-U2VjdGlvbnM="},
+			{"brightcovesearchterm":"brazil","streamurl":"/stream/regionsId/QnJhemls-UmVnaW9ucw=="}]`))
+	}))
+	defer sheet.Close()
+	notifier := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer notifier.Close()
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatalf("[%v]", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "audit.log")
+	audit, err := openAuditLog(path)
+	if err != nil {
+		t.Fatalf("Expected no error. Found: [%v]", err)
+	}
+	mappings, _ := fetchMappings(sheet.URL, nil)
+	mm := metadataMapper{
+		config:   &notifierConfig{cmsMetadataNotifierAddr: notifier.URL},
+		client:   &http.Client{},
+		mappings: mappings,
+		audit:    audit,
+	}
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/notify", strings.NewReader(`{"uuid":"1234","tags":["Brazil","unknown"]}`))
+	req.Header.Set("X-Request-Id", "tid_test")
+	mm.handleNotification(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code: [%d]. Actual: [%d]", http.StatusOK, w.Code)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("[%v]", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("Expected audit entries: [1]. Actual: [%d]", len(lines))
+	}
+	var entry auditEntry
+	if err = json.Unmarshal([]byte(lines[0]), &entry); err != nil {
+		t.Fatalf("[%v]", err)
+	}
+	if entry.UUID != "1234" || entry.TID != "tid_test" || len(entry.UnmappedTags) != 1 || entry.UnmappedTags[0] != "unknown" {
+		t.Errorf("Unexpected audit entry: [%+v]", entry)
+	}
+	if len(entry.Terms) != 1 || entry.Terms[0].Provenance == nil {
+		t.Fatalf("Expected one term with its provenance. Actual: [%+v]", entry.Terms)
+	}
+	//the second mapping is on the third row of the sheet, below the headers
+	if p := entry.Terms[0].Provenance; p.Row != 3 || p.SourceTag != "Brazil" || p.Rule != ruleExact {
+		t.Errorf("Unexpected provenance: [%+v]", *p)
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	breakerClosed   = "closed"
+	breakerOpen     = "open"
+	breakerHalfOpen = "half-open"
+)
+
+var errCircuitOpen = errors.New("Circuit breaker is open, cms-metadata-notifier is considered unavailable")
+
+// circuitBreaker stops calls to cms-metadata-notifier after consecutive failures, letting a single probe through once the probe interval elapsed
+type circuitBreaker struct {
+	sync.Mutex
+	state         string
+	failures      int
+	threshold     int
+	probeInterval time.Duration
+	openedAt      time.Time
+	probing       bool
+	now           func() time.Time
+}
+
+func newCircuitBreaker(threshold int, probeInterval time.Duration) *circuitBreaker {
+	return &circuitBreaker{
+		state:         breakerClosed,
+		threshold:     threshold,
+		probeInterval: probeInterval,
+		now:           time.Now,
+	}
+}
+
+func (cb *circuitBreaker) allow() error {
+	cb.Lock()
+	defer cb.Unlock()
+	switch cb.state {
+	case breakerOpen:
+		if cb.now().Sub(cb.openedAt) < cb.probeInterval {
+			return errCircuitOpen
+		}
+		cb.transition(breakerHalfOpen)
+		cb.probing = true
+		return nil
+	case breakerHalfOpen:
+		if cb.probing {
+			return errCircuitOpen
+		}
+		cb.probing = true
+	}
+	return nil
+}
+
+func (cb *circuitBreaker) success() {
+	cb.Lock()
+	defer cb.Unlock()
+	cb.failures = 0
+	cb.probing = false
+	if cb.state != breakerClosed {
+		cb.transition(breakerClosed)
+	}
+}
+
+func (cb *circuitBreaker) failure() {
+	cb.Lock()
+	defer cb.Unlock()
+	cb.failures++
+	cb.probing = false
+	if cb.state == breakerHalfOpen || (cb.state == breakerClosed && cb.failures >= cb.threshold) {
+		cb.openedAt = cb.now()
+		cb.transition(breakerOpen)
+	}
+}
+
+func (cb *circuitBreaker) currentState() string {
+	cb.Lock()
+	defer cb.Unlock()
+	if cb.state == breakerOpen && cb.now().Sub(cb.openedAt) >= cb.probeInterval {
+		return breakerHalfOpen
+	}
+	return cb.state
+}
+
+func (cb *circuitBreaker) transition(state string) {
+	infoLogger.Printf("Circuit breaker state changed from [%s] to [%s] after [%d] consecutive failures", cb.state, state, cb.failures)
+	cb.state = state
+}
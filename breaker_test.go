@@ -0,0 +1,70 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker_StateTransitions(t *testing.T) {
+	now := time.Now()
+	cb := newCircuitBreaker(2, time.Minute)
+	cb.now = func() time.Time { return now }
+
+	cb.failure()
+	if err := cb.allow(); err != nil {
+		t.Fatalf("Expected closed breaker to allow calls below the threshold. Found: [%v]", err)
+	}
+	cb.failure()
+	if err := cb.allow(); err != errCircuitOpen {
+		t.Fatalf("Expected: [%v]. Actual: [%v]", errCircuitOpen, err)
+	}
+
+	now = now.Add(time.Minute)
+	if state := cb.currentState(); state != breakerHalfOpen {
+		t.Errorf("Expected state: [%s]. Actual: [%s]", breakerHalfOpen, state)
+	}
+	if err := cb.allow(); err != nil {
+		t.Fatalf("Expected a probe to be allowed. Found: [%v]", err)
+	}
+	if err := cb.allow(); err != errCircuitOpen {
+		t.Errorf("Expected a single probe at a time. Actual: [%v]", err)
+	}
+	cb.failure()
+	if state := cb.currentState(); state != breakerOpen {
+		t.Errorf("Expected failed probe to reopen the breaker. Actual state: [%s]", state)
+	}
+
+	now = now.Add(time.Minute)
+	cb.allow()
+	cb.success()
+	if state := cb.currentState(); state != breakerClosed {
+		t.Errorf("Expected state: [%s]. Actual: [%s]", breakerClosed, state)
+	}
+}
+
+func TestSendMetadata_HalfOpenProbeFailsWithoutResponse_ProbeSettled(t *testing.T) {
+	now := time.Now()
+	cb := newCircuitBreaker(1, time.Minute)
+	cb.now = func() time.Time { return now }
+	cb.failure()
+	now = now.Add(time.Minute)
+	mm := metadataMapper{
+		config:  &notifierConfig{cmsMetadataNotifierAddr: "http://invalid\x7f"},
+		client:  &http.Client{},
+		breaker: cb,
+	}
+
+	err := mm.sendMetadata([]byte("{}"), "tid_test")
+	if de, ok := err.(*deliveryError); !ok || de.circuitOpen {
+		t.Fatalf("Expected the probe to fail creating the request. Found: [%v]", err)
+	}
+	if state := cb.currentState(); state != breakerOpen {
+		t.Errorf("Expected the failed probe to reopen the breaker. Actual state: [%s]", state)
+	}
+
+	now = now.Add(time.Minute)
+	if err := cb.allow(); err != nil {
+		t.Errorf("Expected a new probe once the interval elapsed. Found: [%v]", err)
+	}
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// problems found with the concept of a mapping
+const (
+	conceptUnknown      = "unknown"
+	conceptDeprecated   = "deprecated"
+	conceptMerged       = "merged"
+	conceptLookupFailed = "lookup failed"
+)
+
+// how many "merged into" redirects are followed before giving up
+const maxMergeHops = 10
+
+// conceptInfo is the answer of the concept lookup service for a TME ID
+type conceptInfo struct {
+	ID         string   `json:"id"`
+	PrefLabel  string   `json:"prefLabel"`
+	Type       string   `json:"type"`
+	Deprecated bool     `json:"deprecated"`
+	MergedInto string   `json:"mergedInto"`
+	Broader    []string `json:"broader"`
+}
+
+type conceptEntry struct {
+	info    *conceptInfo
+	expires time.Time
+}
+
+// conceptClient looks up TME concepts with GET {url}/{tmeID}, a 404 meaning an unknown concept.
+// The answers are cached for the TTL so that reloads don't query every concept again.
+type conceptClient struct {
+	sync.Mutex
+	url    string
+	client *http.Client
+	ttl    time.Duration
+	cache  map[string]conceptEntry
+	now    func() time.Time
+}
+
+func newConceptClient(conceptURL string, client *http.Client, ttl time.Duration) *conceptClient {
+	return &conceptClient{url: strings.TrimSuffix(conceptURL, "/"), client: client, ttl: ttl, cache: make(map[string]conceptEntry), now: time.Now}
+}
+
+// lookup returns nil when the concept is unknown
+func (cc *conceptClient) lookup(tmeID string) (*conceptInfo, error) {
+	cc.Lock()
+	entry, present := cc.cache[tmeID]
+	cc.Unlock()
+	if present && cc.now().Before(entry.expires) {
+		return entry.info, nil
+	}
+	info, err := cc.fetch(tmeID)
+	if err != nil {
+		return nil, err
+	}
+	cc.Lock()
+	defer cc.Unlock()
+	cc.cache[tmeID] = conceptEntry{info: info, expires: cc.now().Add(cc.ttl)}
+	return info, nil
+}
+
+func (cc *conceptClient) fetch(tmeID string) (*conceptInfo, error) {
+	resp, err := cc.client.Get(cc.url + "/" + url.PathEscape(tmeID))
+	if err != nil {
+		return nil, fmt.Errorf("Looking up concept [%s]: [%v]", tmeID, err)
+	}
+	defer cleanupResp(resp)
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("Looking up concept [%s]: unexpected status code: [%d]", tmeID, resp.StatusCode)
+	}
+	var info conceptInfo
+	if err = json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return nil, fmt.Errorf("Decoding concept [%s]: [%v]", tmeID, err)
+	}
+	return &info, nil
+}
+
+// conceptIssue is a mapping whose concept can't be published as it is
+type conceptIssue struct {
+	Key        string `json:"key"`
+	Row        int    `json:"row,omitempty"`
+	ID         string `json:"id"`
+	Problem    string `json:"problem"`
+	MergedInto string `json:"mergedInto,omitempty"`
+	Followed   bool   `json:"followed,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// validateConcepts checks the concept of every mapping, replacing merged concepts by their target when followMerges is set.
+// Each distinct ID is looked up once.
+func validateConcepts(mappings map[string]term, cc *conceptClient, followMerges bool) []conceptIssue {
+	looked := make(map[string]*conceptInfo)
+	failed := make(map[string]error)
+	lookup := func(id string) (*conceptInfo, error) {
+		if err, present := failed[id]; present {
+			return nil, err
+		}
+		if info, present := looked[id]; present {
+			return info, nil
+		}
+		info, err := cc.lookup(id)
+		if err != nil {
+			failed[id] = err
+			return nil, err
+		}
+		looked[id] = info
+		return info, nil
+	}
+
+	issues := []conceptIssue{}
+	for key, t := range mappings {
+		issue := conceptIssue{Key: key, ID: t.ID}
+		if t.Provenance != nil {
+			issue.Row = t.Provenance.Row
+		}
+		info, err := lookup(t.ID)
+		switch {
+		case err != nil:
+			issue.Problem, issue.Error = conceptLookupFailed, err.Error()
+		case info == nil:
+			issue.Problem = conceptUnknown
+		case info.MergedInto != "":
+			issue.Problem, issue.MergedInto = conceptMerged, info.MergedInto
+			if followMerges {
+				target, err := followMerge(t.ID, lookup)
+				if err != nil {
+					issue.Error = err.Error()
+				} else if taxonomy, err := decodeTaxonomy(target); err != nil {
+					issue.Error = err.Error()
+				} else {
+					t.ID, t.Taxonomy = target, taxonomy
+					mappings[key] = t
+					issue.MergedInto, issue.Followed = target, true
+				}
+			}
+		case info.Deprecated:
+			issue.Problem = conceptDeprecated
+		default:
+			continue
+		}
+		issues = append(issues, issue)
+	}
+	sort.Sort(byRowAndKey(issues))
+	return issues
+}
+
+// enrichLabels replaces the canonical names from the sheet by the preferred labels of the concepts, and sets their type.
+// The sheet value is kept for the concepts without preferred label or which couldn't be looked up.
+func enrichLabels(mappings map[string]term, cc *conceptClient) int {
+	enriched := 0
+	for key, t := range mappings {
+		info, err := cc.lookup(t.ID)
+		if err != nil {
+			warnLogger.Printf("Keeping the sheet label of mapping [%s]: %v", key, err)
+			continue
+		}
+		if info == nil || info.PrefLabel == "" {
+			continue
+		}
+		t.CanonicalName, t.Type = info.PrefLabel, info.Type
+		mappings[key] = t
+		enriched++
+	}
+	return enriched
+}
+
+// followMerge returns the concept the given one was ultimately merged into
+func followMerge(id string, lookup func(id string) (*conceptInfo, error)) (string, error) {
+	from := id
+	visited := map[string]bool{id: true}
+	for hop := 0; hop < maxMergeHops; hop++ {
+		info, err := lookup(id)
+		if err != nil {
+			return "", err
+		}
+		if info == nil {
+			return "", fmt.Errorf("Concept [%s] merged into unknown concept", id)
+		}
+		if info.MergedInto == "" {
+			return id, nil
+		}
+		id = info.MergedInto
+		if visited[id] {
+			return "", fmt.Errorf("Concept merges loop through [%s]", id)
+		}
+		visited[id] = true
+	}
+	return "", fmt.Errorf("More than [%d] concept merges from [%s]", maxMergeHops, from)
+}
+
+type byRowAndKey []conceptIssue
+
+func (c byRowAndKey) Len() int      { return len(c) }
+func (c byRowAndKey) Swap(i, j int) { c[i], c[j] = c[j], c[i] }
+func (c byRowAndKey) Less(i, j int) bool {
+	if c[i].Row != c[j].Row {
+		return c[i].Row < c[j].Row
+	}
+	return c[i].Key < c[j].Key
+}
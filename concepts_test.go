@@ -0,0 +1,105 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newConceptStub(concepts map[string]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, present := concepts[strings.TrimPrefix(r.URL.Path, "/")]
+		if !present {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(body))
+	}))
+}
+
+func TestValidateConcepts_IssuesFlagged(t *testing.T) {
+	ts := newConceptStub(map[string]string{
+		"MQ==-U2VjdGlvbnM=": `{"id":"MQ==-U2VjdGlvbnM=","prefLabel":"World"}`,
+		"Mg==-U2VjdGlvbnM=": `{"id":"Mg==-U2VjdGlvbnM=","deprecated":true}`,
+		"Mw==-U2VjdGlvbnM=": `{"id":"Mw==-U2VjdGlvbnM=","mergedInto":"NA==-U2VjdGlvbnM="}`,
+		"NA==-U2VjdGlvbnM=": `{"id":"NA==-U2VjdGlvbnM=","mergedInto":"NQ==-U2VjdGlvbnM="}`,
+		"NQ==-U2VjdGlvbnM=": `{"id":"NQ==-U2VjdGlvbnM="}`,
+	})
+	defer ts.Close()
+	mappings := map[string]term{
+		"world":      {ID: "MQ==-U2VjdGlvbnM=", Taxonomy: "Sections", Provenance: &provenance{Row: 1}},
+		"deprecated": {ID: "Mg==-U2VjdGlvbnM=", Taxonomy: "Sections", Provenance: &provenance{Row: 2}},
+		"merged":     {ID: "Mw==-U2VjdGlvbnM=", Taxonomy: "Sections", Provenance: &provenance{Row: 3}},
+		"unknown":    {ID: "Ng==-U2VjdGlvbnM=", Taxonomy: "Sections", Provenance: &provenance{Row: 4}},
+	}
+
+	issues := validateConcepts(mappings, newConceptClient(ts.URL, &http.Client{}, time.Hour), true)
+
+	if len(issues) != 3 {
+		t.Fatalf("Expected 3 issues. Found: [%+v]", issues)
+	}
+	if issues[0].Key != "deprecated" || issues[0].Problem != conceptDeprecated {
+		t.Errorf("Unexpected issue: [%+v]", issues[0])
+	}
+	if issues[1].Key != "merged" || issues[1].Problem != conceptMerged || !issues[1].Followed || issues[1].MergedInto != "NQ==-U2VjdGlvbnM=" {
+		t.Errorf("Unexpected issue: [%+v]", issues[1])
+	}
+	if issues[2].Key != "unknown" || issues[2].Problem != conceptUnknown {
+		t.Errorf("Unexpected issue: [%+v]", issues[2])
+	}
+	if mappings["merged"].ID != "NQ==-U2VjdGlvbnM=" {
+		t.Errorf("Expected the merge to be followed. Found: [%s]", mappings["merged"].ID)
+	}
+}
+
+func TestValidateConcepts_MergeLoop_NotFollowed(t *testing.T) {
+	ts := newConceptStub(map[string]string{
+		"MQ==-U2VjdGlvbnM=": `{"mergedInto":"Mg==-U2VjdGlvbnM="}`,
+		"Mg==-U2VjdGlvbnM=": `{"mergedInto":"MQ==-U2VjdGlvbnM="}`,
+	})
+	defer ts.Close()
+	mappings := map[string]term{"world": {ID: "MQ==-U2VjdGlvbnM=", Taxonomy: "Sections"}}
+
+	issues := validateConcepts(mappings, newConceptClient(ts.URL, &http.Client{}, time.Hour), true)
+
+	if len(issues) != 1 || issues[0].Followed || !strings.Contains(issues[0].Error, "loop") {
+		t.Errorf("Expected an unfollowed merge loop. Found: [%+v]", issues)
+	}
+	if mappings["world"].ID != "MQ==-U2VjdGlvbnM=" {
+		t.Errorf("Expected the mapping unchanged. Found: [%s]", mappings["world"].ID)
+	}
+}
+
+func TestEnrichLabels_PrefLabelsUsedAndCached(t *testing.T) {
+	var calls int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if r.URL.Path == "/MQ==-U2VjdGlvbnM=" {
+			w.Write([]byte(`{"id":"MQ==-U2VjdGlvbnM=","prefLabel":"World","type":"Section"}`))
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer ts.Close()
+	cc := newConceptClient(ts.URL, &http.Client{}, time.Hour)
+	mappings := map[string]term{
+		"section:world": {CanonicalName: "section:world", ID: "MQ==-U2VjdGlvbnM=", Taxonomy: "Sections"},
+		"world":         {CanonicalName: "world", ID: "MQ==-U2VjdGlvbnM=", Taxonomy: "Sections"},
+		"section:other": {CanonicalName: "section:other", ID: "Mg==-U2VjdGlvbnM=", Taxonomy: "Sections"},
+	}
+
+	if enriched := enrichLabels(mappings, cc); enriched != 2 {
+		t.Errorf("Expected 2 labels enriched. Found: [%d]", enriched)
+	}
+	if w := mappings["section:world"]; w.CanonicalName != "World" || w.Type != "Section" {
+		t.Errorf("Expected the preferred label and type. Found: [%+v]", w)
+	}
+	if o := mappings["section:other"]; o.CanonicalName != "section:other" {
+		t.Errorf("Expected the sheet label kept. Found: [%+v]", o)
+	}
+	if calls != 2 {
+		t.Errorf("Expected each concept looked up once. Found: [%d] lookups", calls)
+	}
+}
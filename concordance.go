@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	conceptIDsAlongside = "alongside"
+	conceptIDsInstead   = "instead"
+)
+
+const (
+	onConcordanceErrorFallback = "fallback"
+	onConcordanceErrorFail     = "fail"
+)
+
+type concordancesResponse struct {
+	Concordances []concordance `json:"concordances"`
+}
+
+type concordance struct {
+	Concept struct {
+		ID string `json:"id"`
+	} `json:"concept"`
+	Identifier uppIdentifier `json:"identifier"`
+}
+
+type concordanceEntry struct {
+	uuid    string
+	expires time.Time
+}
+
+// concordanceResolver resolves TME IDs to UPP concept UUIDs through a concordances API, caching the answers, including the misses
+type concordanceResolver struct {
+	sync.Mutex
+	url    string
+	client *http.Client
+	ttl    time.Duration
+	cache  map[string]concordanceEntry
+	now    func() time.Time
+}
+
+func newConcordanceResolver(concordanceURL string, client *http.Client, ttl time.Duration) *concordanceResolver {
+	return &concordanceResolver{url: concordanceURL, client: client, ttl: ttl, cache: make(map[string]concordanceEntry), now: time.Now}
+}
+
+// resolve returns an empty UUID when the TME ID has no concordance
+func (cr *concordanceResolver) resolve(tmeID string, tid string) (string, error) {
+	cr.Lock()
+	entry, present := cr.cache[tmeID]
+	cr.Unlock()
+	if present && cr.now().Before(entry.expires) {
+		return entry.uuid, nil
+	}
+
+	uuid, err := cr.lookup(tmeID, tid)
+	if err != nil {
+		return "", err
+	}
+	cr.Lock()
+	defer cr.Unlock()
+	cr.cache[tmeID] = concordanceEntry{uuid: uuid, expires: cr.now().Add(cr.ttl)}
+	return uuid, nil
+}
+
+func (cr *concordanceResolver) lookup(tmeID string, tid string) (string, error) {
+	params := url.Values{}
+	params.Set("authority", tmeAuthority)
+	params.Set("identifierValue", tmeID)
+	req, err := http.NewRequest("GET", cr.url+"?"+params.Encode(), nil)
+	if err != nil {
+		return "", fmt.Errorf("Creating concordance request: [%v]", err)
+	}
+	req.Header.Add("X-Request-Id", tid)
+	resp, err := cr.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("Looking up concordance of TME ID [%s]: [%v]", tmeID, err)
+	}
+	defer cleanupResp(resp)
+	if resp.StatusCode == http.StatusNotFound {
+		return "", nil
+	}
+	if resp.StatusCode != 200 {
+		return "", fmt.Errorf("Looking up concordance of TME ID [%s]: unexpected status code: [%d]", tmeID, resp.StatusCode)
+	}
+	var body concordancesResponse
+	if err = json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("Decoding concordance of TME ID [%s]: [%v]", tmeID, err)
+	}
+	for _, c := range body.Concordances {
+		if c.Identifier.IdentifierValue == tmeID || c.Identifier.IdentifierValue == "" {
+			return strings.TrimPrefix(c.Concept.ID, thingsURL), nil
+		}
+	}
+	return "", nil
+}
+
+// resolveConcepts sets the UPP UUID of the terms having a concordance. Lookup failures either fail the whole
+// notification or leave the term with its TME ID only, as configured.
+func (mm *metadataMapper) resolveConcepts(terms []term, tid string) ([]term, error) {
+	if mm.concordances == nil {
+		return terms, nil
+	}
+	resolved := make([]term, 0, len(terms))
+	for _, t := range terms {
+		uuid, err := mm.concordances.resolve(t.ID, tid)
+		if err != nil {
+			if mm.config.onConcordanceError == onConcordanceErrorFail {
+				return nil, err
+			}
+			warnLogger.Printf("tid=[%s]. Sending TME ID only for [%s]: %v", tid, t.ID, err)
+		} else if uuid == "" {
+			infoLogger.Printf("tid=[%s]. TME ID [%s] has no UPP concordance", tid, t.ID)
+		}
+		t.UUID = uuid
+		resolved = append(resolved, t)
+	}
+	return resolved, nil
+}
+
+func (mm *metadataMapper) conceptIDs() string {
+	if mm.config == nil || mm.config.conceptIDs == "" {
+		return conceptIDsAlongside
+	}
+	return mm.config.conceptIDs
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newConcordanceStub(t *testing.T, concordances map[string]string, calls *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(calls, 1)
+		if r.URL.Query().Get("authority") != tmeAuthority {
+			t.Errorf("Unexpected authority: [%s]", r.URL.Query().Get("authority"))
+		}
+		id := r.URL.Query().Get("identifierValue")
+		uuid, present := concordances[id]
+		if !present {
+			fmt.Fprint(w, `{"concordances":[]}`)
+			return
+		}
+		fmt.Fprintf(w, `{"concordances":[{"concept":{"id":"%s%s"},"identifier":{"authority":"%s","identifierValue":"%s"}}]}`, thingsURL, uuid, tmeAuthority, id)
+	}))
+}
+
+func TestConcordanceResolver_Resolve_CachedUntilExpired(t *testing.T) {
+	var calls int32
+	ts := newConcordanceStub(t, map[string]string{"MTA2-U2VjdGlvbnM=": "c9e0aab6-3ef6-4f4b-8c79-3bd8e8e2e1f4"}, &calls)
+	defer ts.Close()
+	cr := newConcordanceResolver(ts.URL, &http.Client{}, time.Hour)
+	now := time.Now()
+	cr.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		uuid, err := cr.resolve("MTA2-U2VjdGlvbnM=", "tid_test")
+		if err != nil || uuid != "c9e0aab6-3ef6-4f4b-8c79-3bd8e8e2e1f4" {
+			t.Fatalf("Unexpected concordance: [%s] [%v]", uuid, err)
+		}
+	}
+	if uuid, _ := cr.resolve("MTA1-U2VjdGlvbnM=", "tid_test"); uuid != "" {
+		t.Errorf("Expected no concordance. Found: [%s]", uuid)
+	}
+	cr.resolve("MTA1-U2VjdGlvbnM=", "tid_test")
+	if calls != 2 {
+		t.Errorf("Expected 2 lookups, hits and misses cached. Found: [%d]", calls)
+	}
+
+	now = now.Add(2 * time.Hour)
+	cr.resolve("MTA2-U2VjdGlvbnM=", "tid_test")
+	if calls != 3 {
+		t.Errorf("Expected a new lookup once expired. Found: [%d] lookups", calls)
+	}
+}
+
+func TestResolveConcepts_LookupFails_FallbackOrFail(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+	terms := []term{{CanonicalName: "Emerging-Markets", ID: "MTA2-U2VjdGlvbnM=", Taxonomy: "Sections"}}
+
+	mm := metadataMapper{
+		config:       &notifierConfig{onConcordanceError: onConcordanceErrorFallback},
+		concordances: newConcordanceResolver(ts.URL, &http.Client{}, time.Hour),
+	}
+	resolved, err := mm.resolveConcepts(terms, "tid_test")
+	if err != nil || len(resolved) != 1 || resolved[0].UUID != "" {
+		t.Errorf("Expected the TME ID only. Found: [%+v] [%v]", resolved, err)
+	}
+	if len(mm.concordances.cache) != 0 {
+		t.Error("Expected failed lookups not to be cached.")
+	}
+
+	mm.config.onConcordanceError = onConcordanceErrorFail
+	if _, err = mm.resolveConcepts(terms, "tid_test"); err == nil {
+		t.Error("Expected error.")
+	}
+}
+
+func TestFormatters_ConceptIDsInstead_UUIDReplacesTMEID(t *testing.T) {
+	terms := []term{
+		{CanonicalName: "Emerging-Markets", ID: "MTA2-U2VjdGlvbnM=", UUID: "c9e0aab6-3ef6-4f4b-8c79-3bd8e8e2e1f4", Taxonomy: "Sections"},
+		{CanonicalName: "John Authers", ID: "Q0ItMDAwMDkyMw==-QXV0aG9ycw==", Taxonomy: "Authors"},
+	}
+
+	xmlFormatter, _ := newFormatter(formatXML, conceptIDsInstead, false)
+	payload, err := xmlFormatter.format("1234", terms)
+	if err != nil {
+		t.Fatalf("Expected no error. Found: [%v]", err)
+	}
+	if !strings.Contains(string(payload), `id="c9e0aab6-3ef6-4f4b-8c79-3bd8e8e2e1f4"`) || strings.Contains(string(payload), "MTA2-U2VjdGlvbnM=") {
+		t.Errorf("Expected the UUID instead of the TME ID. Found: [%s]", payload)
+	}
+	if !strings.Contains(string(payload), `id="Q0ItMDAwMDkyMw==-QXV0aG9ycw=="`) {
+		t.Errorf("Expected the TME ID of the term without concordance. Found: [%s]", payload)
+	}
+
+	alongside, _ := newFormatter(formatXML, conceptIDsAlongside, false)
+	payload, _ = alongside.format("1234", terms)
+	if !strings.Contains(string(payload), `id="MTA2-U2VjdGlvbnM=" uuid="c9e0aab6-3ef6-4f4b-8c79-3bd8e8e2e1f4"`) {
+		t.Errorf("Expected the UUID alongside the TME ID. Found: [%s]", payload)
+	}
+
+	jsonFormatter, _ := newFormatter(formatJSON, conceptIDsInstead, false)
+	payload, _ = jsonFormatter.format("1234", terms)
+	if !strings.Contains(string(payload), thingsURL+"c9e0aab6-3ef6-4f4b-8c79-3bd8e8e2e1f4") || strings.Contains(string(payload), "MTA2-U2VjdGlvbnM=") {
+		t.Errorf("Expected the UUID instead of the TME ID. Found: [%s]", payload)
+	}
+}
@@ -10,17 +10,35 @@ type tags struct {
 }
 
 type tag struct {
-	Term     term     `xml:"term"`
-	TagScore tagScore `xml:"score"`
+	Predicate string   `xml:"predicate,attr,omitempty"`
+	Term      term     `xml:"term"`
+	TagScore  tagScore `xml:"score"`
 }
 
 type term struct {
-	CanonicalName string `xml:"canonicalName,omitempty"`
-	Taxonomy      string `xml:"taxonomy,attr"`
-	ID            string `xml:"id,attr"`
+	CanonicalName string      `xml:"canonicalName,omitempty" json:"canonicalName"`
+	Taxonomy      string      `xml:"taxonomy,attr" json:"taxonomy"`
+	ID            string      `xml:"id,attr" json:"id"`
+	UUID          string      `xml:"uuid,attr,omitempty" json:"uuid,omitempty"`
+	Predicate     string      `xml:"-" json:"predicate,omitempty"`
+	Type          string      `xml:"-" json:"type,omitempty"`
+	Score         *tagScore   `xml:"-" json:"score,omitempty"`
+	Provenance    *provenance `xml:"-" json:"provenance,omitempty"`
+}
+
+// provenance explains which mapping produced a term; it's never sent downstream
+type provenance struct {
+	SourceTag      string `json:"sourceTag"`
+	Key            string `json:"key"`
+	Rule           string `json:"rule"`
+	Row            int    `json:"row"`
+	MappingVersion string `json:"mappingVersion"`
+	Field          string `json:"field,omitempty"`
+	ExpandedFrom   string `json:"expandedFrom,omitempty"`
+	Depth          int    `json:"depth,omitempty"`
 }
 
 type tagScore struct {
-	Confidence int `xml:"confidence,attr"`
-	Relevance  int `xml:"relevance,attr"`
+	Confidence int `xml:"confidence,attr" json:"confidence"`
+	Relevance  int `xml:"relevance,attr" json:"relevance"`
 }
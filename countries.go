@@ -0,0 +1,103 @@
+package main
+
+// country lists the ways a country is named in tags: its ISO 3166-1 alpha-2 code, common names, the first being the
+// canonical one, and demonyms
+type country struct {
+	Code     string
+	Names    []string
+	Demonyms []string
+}
+
+var countries = []country{
+	{"AE", []string{"United Arab Emirates", "UAE", "Emirates"}, []string{"Emirati"}},
+	{"AF", []string{"Afghanistan"}, []string{"Afghan"}},
+	{"AR", []string{"Argentina"}, []string{"Argentine", "Argentinian"}},
+	{"AT", []string{"Austria"}, []string{"Austrian"}},
+	{"AU", []string{"Australia"}, []string{"Australian"}},
+	{"BD", []string{"Bangladesh"}, []string{"Bangladeshi"}},
+	{"BE", []string{"Belgium"}, []string{"Belgian"}},
+	{"BG", []string{"Bulgaria"}, []string{"Bulgarian"}},
+	{"BR", []string{"Brazil", "Brasil"}, []string{"Brazilian"}},
+	{"BY", []string{"Belarus"}, []string{"Belarusian"}},
+	{"CA", []string{"Canada"}, []string{"Canadian"}},
+	{"CH", []string{"Switzerland"}, []string{"Swiss"}},
+	{"CL", []string{"Chile"}, []string{"Chilean"}},
+	{"CN", []string{"China", "People's Republic of China", "PRC", "Mainland China"}, []string{"Chinese"}},
+	{"CO", []string{"Colombia"}, []string{"Colombian"}},
+	{"CZ", []string{"Czech Republic", "Czechia"}, []string{"Czech"}},
+	{"DE", []string{"Germany", "Deutschland"}, []string{"German"}},
+	{"DK", []string{"Denmark"}, []string{"Danish", "Dane"}},
+	{"DZ", []string{"Algeria"}, []string{"Algerian"}},
+	{"EE", []string{"Estonia"}, []string{"Estonian"}},
+	{"EG", []string{"Egypt"}, []string{"Egyptian"}},
+	{"ES", []string{"Spain", "España"}, []string{"Spanish", "Spaniard"}},
+	{"ET", []string{"Ethiopia"}, []string{"Ethiopian"}},
+	{"FI", []string{"Finland"}, []string{"Finnish", "Finn"}},
+	{"FR", []string{"France"}, []string{"French"}},
+	{"GB", []string{"United Kingdom", "UK", "Britain", "Great Britain"}, []string{"British", "Briton"}},
+	{"GH", []string{"Ghana"}, []string{"Ghanaian"}},
+	{"GR", []string{"Greece"}, []string{"Greek"}},
+	{"HK", []string{"Hong Kong"}, []string{"Hongkonger"}},
+	{"HR", []string{"Croatia"}, []string{"Croatian", "Croat"}},
+	{"HU", []string{"Hungary"}, []string{"Hungarian"}},
+	{"ID", []string{"Indonesia"}, []string{"Indonesian"}},
+	{"IE", []string{"Ireland", "Republic of Ireland", "Eire"}, []string{"Irish"}},
+	{"IL", []string{"Israel"}, []string{"Israeli"}},
+	{"IN", []string{"India"}, []string{"Indian"}},
+	{"IQ", []string{"Iraq"}, []string{"Iraqi"}},
+	{"IR", []string{"Iran"}, []string{"Iranian"}},
+	{"IS", []string{"Iceland"}, []string{"Icelandic", "Icelander"}},
+	{"IT", []string{"Italy", "Italia"}, []string{"Italian"}},
+	{"JO", []string{"Jordan"}, []string{"Jordanian"}},
+	{"JP", []string{"Japan"}, []string{"Japanese"}},
+	{"KE", []string{"Kenya"}, []string{"Kenyan"}},
+	{"KP", []string{"North Korea", "DPRK"}, []string{"North Korean"}},
+	{"KR", []string{"South Korea", "Korea", "Republic of Korea"}, []string{"South Korean", "Korean"}},
+	{"KW", []string{"Kuwait"}, []string{"Kuwaiti"}},
+	{"KZ", []string{"Kazakhstan"}, []string{"Kazakh", "Kazakhstani"}},
+	{"LB", []string{"Lebanon"}, []string{"Lebanese"}},
+	{"LT", []string{"Lithuania"}, []string{"Lithuanian"}},
+	{"LU", []string{"Luxembourg"}, []string{"Luxembourgish", "Luxembourger"}},
+	{"LV", []string{"Latvia"}, []string{"Latvian"}},
+	{"LY", []string{"Libya"}, []string{"Libyan"}},
+	{"MA", []string{"Morocco"}, []string{"Moroccan"}},
+	{"MX", []string{"Mexico"}, []string{"Mexican"}},
+	{"MY", []string{"Malaysia"}, []string{"Malaysian"}},
+	{"NG", []string{"Nigeria"}, []string{"Nigerian"}},
+	{"NL", []string{"Netherlands", "Holland"}, []string{"Dutch"}},
+	{"NO", []string{"Norway"}, []string{"Norwegian"}},
+	{"NZ", []string{"New Zealand"}, []string{"New Zealander", "Kiwi"}},
+	{"PE", []string{"Peru"}, []string{"Peruvian"}},
+	{"PH", []string{"Philippines"}, []string{"Philippine", "Filipino"}},
+	{"PK", []string{"Pakistan"}, []string{"Pakistani"}},
+	{"PL", []string{"Poland"}, []string{"Polish", "Pole"}},
+	{"PT", []string{"Portugal"}, []string{"Portuguese"}},
+	{"QA", []string{"Qatar"}, []string{"Qatari"}},
+	{"RO", []string{"Romania"}, []string{"Romanian"}},
+	{"RS", []string{"Serbia"}, []string{"Serbian", "Serb"}},
+	{"RU", []string{"Russia", "Russian Federation"}, []string{"Russian"}},
+	{"SA", []string{"Saudi Arabia"}, []string{"Saudi", "Saudi Arabian"}},
+	{"SE", []string{"Sweden"}, []string{"Swedish", "Swede"}},
+	{"SG", []string{"Singapore"}, []string{"Singaporean"}},
+	{"SK", []string{"Slovakia"}, []string{"Slovak"}},
+	{"SI", []string{"Slovenia"}, []string{"Slovenian", "Slovene"}},
+	{"SY", []string{"Syria"}, []string{"Syrian"}},
+	{"TH", []string{"Thailand"}, []string{"Thai"}},
+	{"TR", []string{"Turkey", "Türkiye"}, []string{"Turkish", "Turk"}},
+	{"TW", []string{"Taiwan"}, []string{"Taiwanese"}},
+	{"UA", []string{"Ukraine"}, []string{"Ukrainian"}},
+	{"US", []string{"United States", "USA", "United States of America", "America"}, []string{"American"}},
+	{"VE", []string{"Venezuela"}, []string{"Venezuelan"}},
+	{"VN", []string{"Vietnam", "Viet Nam"}, []string{"Vietnamese"}},
+	{"ZA", []string{"South Africa"}, []string{"South African"}},
+	{"ZW", []string{"Zimbabwe"}, []string{"Zimbabwean"}},
+}
+
+// names which usually mean something else than the country, e.g. a person called Jordan, only looked up in the
+// geographical namespaces
+var ambiguousPlaces = map[string]bool{
+	"america": true,
+	"jordan":  true,
+	"korea":   true,
+	"turkey":  true,
+}
@@ -0,0 +1,369 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Financial-Times/transactionid-utils-go"
+	"github.com/gorilla/mux"
+)
+
+type deadLetter struct {
+	ID           string                             `json:"id"`
+	TID          string                             `json:"tid"`
+	UUID         string                             `json:"uuid"`
+	Event        *nativeCmsMetadataPublicationEvent `json:"event"`
+	StatusCode   int                                `json:"statusCode,omitempty"`
+	ResponseBody string                             `json:"responseBody,omitempty"`
+	Error        string                             `json:"error"`
+	Replays      int                                `json:"replays"`
+	Superseded   bool                               `json:"superseded,omitempty"`
+	Created      time.Time                          `json:"created"`
+	Updated      time.Time                          `json:"updated"`
+}
+
+var (
+	errDeadLetterSuperseded = errors.New("A newer metadata event for the video was sent since")
+	errDeadLetterInProgress = errors.New("A notification for the video is being sent")
+	errDeadLetterNotLatest  = errors.New("A newer dead letter for the video is stored, only the latest one can be replayed")
+)
+
+// deadLetterStore keeps the notifications which ultimately failed delivery, one file per entry when a directory is configured.
+// Beyond the limit, the oldest entries are dropped.
+type deadLetterStore struct {
+	sync.RWMutex
+	dir     string
+	limit   int
+	entries map[string]*deadLetter
+}
+
+func newDeadLetterStore(dir string, limit int) (*deadLetterStore, error) {
+	s := &deadLetterStore{dir: dir, limit: limit, entries: make(map[string]*deadLetter)}
+	if dir == "" {
+		return s, nil
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("Creating dead letter directory: [%v]", err)
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("Reading dead letter directory: [%v]", err)
+	}
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), ".json") {
+			continue
+		}
+		data, err := ioutil.ReadFile(filepath.Join(dir, f.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("Reading dead letter [%s]: [%v]", f.Name(), err)
+		}
+		var dl deadLetter
+		if err = json.Unmarshal(data, &dl); err != nil {
+			warnLogger.Printf("Skipping unreadable dead letter [%s]: [%v]", f.Name(), err)
+			continue
+		}
+		s.entries[dl.ID] = &dl
+	}
+	return s, nil
+}
+
+func (s *deadLetterStore) add(ev *nativeCmsMetadataPublicationEvent, tid string, cause error) (deadLetter, error) {
+	id, err := newTrackingID()
+	if err != nil {
+		return deadLetter{}, err
+	}
+	now := time.Now().UTC()
+	dl := &deadLetter{ID: id, TID: tid, UUID: ev.UUID, Event: ev, Created: now}
+	dl.recordFailure(cause, now)
+
+	s.Lock()
+	defer s.Unlock()
+	if err = s.persist(dl); err != nil {
+		return deadLetter{}, err
+	}
+	s.entries[id] = dl
+	for s.limit > 0 && len(s.entries) > s.limit {
+		s.evictOldestLocked()
+	}
+	return *dl, nil
+}
+
+func (s *deadLetterStore) evictOldestLocked() {
+	var oldest *deadLetter
+	for _, dl := range s.entries {
+		if oldest == nil || dl.Created.Before(oldest.Created) {
+			oldest = dl
+		}
+	}
+	errorLogger.Printf("Dead letter limit [%d] reached, dropping dead letter=[%s] for video=[%s]", s.limit, oldest.ID, oldest.UUID)
+	if s.dir != "" {
+		if err := os.Remove(s.file(oldest.ID)); err != nil && !os.IsNotExist(err) {
+			errorLogger.Printf("Removing dead letter [%s]: [%v]", oldest.ID, err)
+		}
+	}
+	delete(s.entries, oldest.ID)
+}
+
+// supersede flags the dead letters of a video created before the given time, once a newer event for it was delivered,
+// so they aren't replayed
+func (s *deadLetterStore) supersede(uuid string, before time.Time) error {
+	s.Lock()
+	defer s.Unlock()
+	for _, dl := range s.entries {
+		if dl.UUID != uuid || dl.Superseded || !dl.Created.Before(before) {
+			continue
+		}
+		dl.Superseded = true
+		if err := s.persist(dl); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// latest tells whether no dead letter of the video, still to be replayed, is newer than the given one
+func (s *deadLetterStore) latest(dl deadLetter) bool {
+	s.RLock()
+	defer s.RUnlock()
+	for _, other := range s.entries {
+		if other.UUID == dl.UUID && !other.Superseded && other.Created.After(dl.Created) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *deadLetterStore) get(id string) (deadLetter, bool) {
+	s.RLock()
+	defer s.RUnlock()
+	dl, present := s.entries[id]
+	if !present {
+		return deadLetter{}, false
+	}
+	return *dl, true
+}
+
+// list returns the entries oldest first
+func (s *deadLetterStore) list() []deadLetter {
+	s.RLock()
+	defer s.RUnlock()
+	dls := make([]deadLetter, 0, len(s.entries))
+	for _, dl := range s.entries {
+		dls = append(dls, *dl)
+	}
+	sort.Sort(byCreated(dls))
+	return dls
+}
+
+func (s *deadLetterStore) replayFailed(id string, cause error) error {
+	s.Lock()
+	defer s.Unlock()
+	dl, present := s.entries[id]
+	if !present {
+		return nil
+	}
+	dl.Replays++
+	dl.recordFailure(cause, time.Now().UTC())
+	return s.persist(dl)
+}
+
+func (s *deadLetterStore) remove(id string) (bool, error) {
+	s.Lock()
+	defer s.Unlock()
+	if _, present := s.entries[id]; !present {
+		return false, nil
+	}
+	if s.dir != "" {
+		if err := os.Remove(s.file(id)); err != nil && !os.IsNotExist(err) {
+			return false, fmt.Errorf("Removing dead letter [%s]: [%v]", id, err)
+		}
+	}
+	delete(s.entries, id)
+	return true, nil
+}
+
+func (s *deadLetterStore) persist(dl *deadLetter) error {
+	dl.Updated = time.Now().UTC()
+	if s.dir == "" {
+		return nil
+	}
+	data, err := json.Marshal(dl)
+	if err != nil {
+		return fmt.Errorf("Marshalling dead letter [%s]: [%v]", dl.ID, err)
+	}
+	tmp := s.file(dl.ID) + ".tmp"
+	if err = ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("Writing dead letter [%s]: [%v]", dl.ID, err)
+	}
+	if err = os.Rename(tmp, s.file(dl.ID)); err != nil {
+		return fmt.Errorf("Writing dead letter [%s]: [%v]", dl.ID, err)
+	}
+	return nil
+}
+
+func (s *deadLetterStore) file(id string) string {
+	return filepath.Join(s.dir, id+".json")
+}
+
+func (dl *deadLetter) recordFailure(cause error, at time.Time) {
+	dl.Error = cause.Error()
+	dl.StatusCode = 0
+	dl.ResponseBody = ""
+	if de, ok := cause.(*deliveryError); ok {
+		dl.StatusCode = de.statusCode
+		dl.ResponseBody = de.body
+	}
+	dl.Updated = at
+}
+
+type byCreated []deadLetter
+
+func (d byCreated) Len() int           { return len(d) }
+func (d byCreated) Swap(i, j int)      { d[i], d[j] = d[j], d[i] }
+func (d byCreated) Less(i, j int) bool { return d[i].Created.Before(d[j].Created) }
+
+// deadLetter stores the failed event, reporting whether it was written to disk
+func (mm *metadataMapper) deadLetter(ev *nativeCmsMetadataPublicationEvent, tid string, cause error) bool {
+	dl, err := mm.deadLetters.add(ev, tid, cause)
+	if err != nil {
+		errorLogger.Printf("tid=[%s]. Couldn't dead letter metadata event for video=[%s]: %v", tid, ev.UUID, err)
+		return false
+	}
+	warnLogger.Printf("tid=[%s]. Metadata event for video=[%s] stored as dead letter=[%s]", tid, ev.UUID, dl.ID)
+	return mm.deadLetters.dir != ""
+}
+
+func (mm *metadataMapper) supersedeDeadLetters(uuid string, before time.Time, tid string) {
+	if err := mm.deadLetters.supersede(uuid, before); err != nil {
+		errorLogger.Printf("tid=[%s]. %v", tid, err)
+	}
+}
+
+// replayDeadLetter sends the stored event again, dropping the entry once it's delivered along with the older ones of
+// the video. It refuses to when a newer event for the video was sent since, is being sent or is stored as a dead
+// letter, so an old tag set doesn't land over it.
+func (mm *metadataMapper) replayDeadLetter(dl deadLetter, tid string) error {
+	if dl.Superseded {
+		return errDeadLetterSuperseded
+	}
+	if !mm.deadLetters.latest(dl) {
+		return errDeadLetterNotLatest
+	}
+	if mm.sequencer != nil {
+		seq, idle := mm.sequencer.registerIdle(dl.UUID)
+		if !idle {
+			return errDeadLetterInProgress
+		}
+		superseded := mm.sequencer.acquire(dl.UUID, seq)
+		defer mm.sequencer.release(dl.UUID)
+		if superseded {
+			return errDeadLetterInProgress
+		}
+	}
+	infoLogger.Printf("tid=[%s]. Replaying dead letter=[%s] for video=[%s], originally tid=[%s]", tid, dl.ID, dl.UUID, dl.TID)
+	if err := mm.send(dl.Event, tid); err != nil {
+		if storeErr := mm.deadLetters.replayFailed(dl.ID, err); storeErr != nil {
+			errorLogger.Printf("tid=[%s]. %v", tid, storeErr)
+		}
+		return err
+	}
+	mm.supersedeDeadLetters(dl.UUID, dl.Created, tid)
+	if _, err := mm.deadLetters.remove(dl.ID); err != nil {
+		errorLogger.Printf("tid=[%s]. %v", tid, err)
+	}
+	return nil
+}
+
+func (mm *metadataMapper) handleListDeadLetters(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, mm.deadLetters.list())
+}
+
+func (mm *metadataMapper) handleGetDeadLetter(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	dl, present := mm.deadLetters.get(id)
+	if !present {
+		handleErr(w, http.StatusNotFound, fmt.Sprintf("Unknown dead letter=[%s]", id))
+		return
+	}
+	writeJSON(w, http.StatusOK, dl)
+}
+
+func (mm *metadataMapper) handleReplayDeadLetter(w http.ResponseWriter, r *http.Request) {
+	tid := transactionidutils.GetTransactionIDFromRequest(r)
+	id := mux.Vars(r)["id"]
+	dl, present := mm.deadLetters.get(id)
+	if !present {
+		handleErr(w, http.StatusNotFound, fmt.Sprintf("tid=[%s]. Unknown dead letter=[%s]", tid, id))
+		return
+	}
+	err := mm.replayDeadLetter(dl, tid)
+	switch err {
+	case nil:
+	case errDeadLetterSuperseded, errDeadLetterInProgress, errDeadLetterNotLatest:
+		handleErr(w, http.StatusConflict, fmt.Sprintf("tid=[%s]. Not replaying dead letter=[%s]: %v", tid, id, err))
+	default:
+		handleErr(w, http.StatusBadGateway, fmt.Sprintf("tid=[%s]. Replaying dead letter=[%s]: %v", tid, id, err))
+	}
+}
+
+type replaySummary struct {
+	Replayed int      `json:"replayed"`
+	Failed   []string `json:"failed"`
+	Skipped  []string `json:"skipped"`
+}
+
+func (mm *metadataMapper) handleReplayAllDeadLetters(w http.ResponseWriter, r *http.Request) {
+	tid := transactionidutils.GetTransactionIDFromRequest(r)
+	summary := replaySummary{Failed: []string{}, Skipped: []string{}}
+	//only the latest dead letter of each video is replayed, the older ones being skipped as not latest
+	for _, dl := range mm.deadLetters.list() {
+		err := mm.replayDeadLetter(dl, tid)
+		if err == errDeadLetterSuperseded || err == errDeadLetterInProgress || err == errDeadLetterNotLatest {
+			infoLogger.Printf("tid=[%s]. Not replaying dead letter=[%s]: %v", tid, dl.ID, err)
+			summary.Skipped = append(summary.Skipped, dl.ID)
+			continue
+		}
+		if err != nil {
+			warnLogger.Printf("tid=[%s]. Replaying dead letter=[%s]: %v", tid, dl.ID, err)
+			summary.Failed = append(summary.Failed, dl.ID)
+			continue
+		}
+		summary.Replayed++
+	}
+	infoLogger.Printf("tid=[%s]. Replayed [%d] dead letters, [%d] failed, [%d] skipped", tid, summary.Replayed, len(summary.Failed), len(summary.Skipped))
+	writeJSON(w, http.StatusOK, summary)
+}
+
+func (mm *metadataMapper) handleDeleteDeadLetter(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	removed, err := mm.deadLetters.remove(id)
+	if err != nil {
+		handleServerErr(w, err.Error())
+		return
+	}
+	if !removed {
+		handleErr(w, http.StatusNotFound, fmt.Sprintf("Unknown dead letter=[%s]", id))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (mm *metadataMapper) handlePurgeDeadLetters(w http.ResponseWriter, r *http.Request) {
+	for _, dl := range mm.deadLetters.list() {
+		if _, err := mm.deadLetters.remove(dl.ID); err != nil {
+			handleServerErr(w, err.Error())
+			return
+		}
+	}
+	infoLogger.Println("Purged dead letters")
+	w.WriteHeader(http.StatusNoContent)
+}
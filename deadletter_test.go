@@ -0,0 +1,204 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func TestDeliver_FailedDelivery_DeadLetteredWithDownstreamResponse(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("invalid metadata"))
+	}))
+	defer ts.Close()
+	store, _ := newDeadLetterStore("", 0)
+	mm := metadataMapper{
+		config:      &notifierConfig{cmsMetadataNotifierAddr: ts.URL},
+		client:      &http.Client{},
+		deadLetters: store,
+	}
+
+	if err := mm.deliver(&nativeCmsMetadataPublicationEvent{UUID: "1234", Value: "value"}, "test_tid"); err == nil {
+		t.Fatal("Expected error.")
+	}
+	dls := store.list()
+	if len(dls) != 1 {
+		t.Fatalf("Expected dead letters: [1]. Actual: [%d]", len(dls))
+	}
+	if dls[0].UUID != "1234" || dls[0].TID != "test_tid" || dls[0].StatusCode != http.StatusBadRequest || dls[0].ResponseBody != "invalid metadata" {
+		t.Errorf("Unexpected dead letter: [%+v]", dls[0])
+	}
+}
+
+func TestDeadLetterStore_EntriesSurviveReopen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dead-letters")
+	if err != nil {
+		t.Fatalf("[%v]", err)
+	}
+	defer os.RemoveAll(dir)
+
+	store, err := newDeadLetterStore(dir, 0)
+	if err != nil {
+		t.Fatalf("Expected no error. Found: [%v]", err)
+	}
+	kept, _ := store.add(&nativeCmsMetadataPublicationEvent{UUID: "1234"}, "tid_1", &deliveryError{msg: "failed", statusCode: 503})
+	removed, _ := store.add(&nativeCmsMetadataPublicationEvent{UUID: "5678"}, "tid_2", &deliveryError{msg: "failed"})
+	store.remove(removed.ID)
+
+	reopened, err := newDeadLetterStore(dir, 0)
+	if err != nil {
+		t.Fatalf("Expected no error. Found: [%v]", err)
+	}
+	dls := reopened.list()
+	if len(dls) != 1 || dls[0].ID != kept.ID || dls[0].StatusCode != 503 {
+		t.Errorf("Expected only dead letter [%s] to be kept. Actual: [%+v]", kept.ID, dls)
+	}
+}
+
+func TestHandleReplayAllDeadLetters_DeliveredEntriesRemoved(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+	store, _ := newDeadLetterStore("", 0)
+	store.add(&nativeCmsMetadataPublicationEvent{UUID: "1234"}, "tid_1", &deliveryError{msg: "failed"})
+	store.add(&nativeCmsMetadataPublicationEvent{UUID: "5678"}, "tid_2", &deliveryError{msg: "failed"})
+	mm := metadataMapper{
+		config:      &notifierConfig{cmsMetadataNotifierAddr: ts.URL},
+		client:      &http.Client{},
+		deadLetters: store,
+	}
+	r := mux.NewRouter()
+	r.HandleFunc("/__dead-letters/replay", mm.handleReplayAllDeadLetters).Methods("POST")
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/__dead-letters/replay", nil)
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code: [%d]. Actual: [%d]", http.StatusOK, w.Code)
+	}
+	var summary replaySummary
+	if err := json.NewDecoder(w.Body).Decode(&summary); err != nil {
+		t.Fatalf("[%v]", err)
+	}
+	if summary.Replayed != 2 || len(summary.Failed) != 0 {
+		t.Errorf("Unexpected replay summary: [%+v]", summary)
+	}
+	if len(store.list()) != 0 {
+		t.Errorf("Expected no dead letters left. Actual: [%d]", len(store.list()))
+	}
+}
+
+func TestHandleReplayDeadLetter_NewerEventSentSince_Refused(t *testing.T) {
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+	}))
+	defer ts.Close()
+	store, _ := newDeadLetterStore("", 0)
+	dl, _ := store.add(&nativeCmsMetadataPublicationEvent{UUID: "1234", Value: "old"}, "tid_1", &deliveryError{msg: "failed"})
+	mm := metadataMapper{
+		config:      &notifierConfig{cmsMetadataNotifierAddr: ts.URL},
+		client:      &http.Client{},
+		deadLetters: store,
+		sequencer:   newVideoSequencer(),
+	}
+	if err := mm.deliver(&nativeCmsMetadataPublicationEvent{UUID: "1234", Value: "new"}, "tid_2"); err != nil {
+		t.Fatalf("Expected no error. Found: [%v]", err)
+	}
+	r := mux.NewRouter()
+	r.HandleFunc("/__dead-letters/{id}/replay", mm.handleReplayDeadLetter).Methods("POST")
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/__dead-letters/"+dl.ID+"/replay", nil)
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusConflict {
+		t.Errorf("Expected status code: [%d]. Actual: [%d]", http.StatusConflict, w.Code)
+	}
+	if requests != 1 {
+		t.Errorf("Expected only the newer event to be sent. Requests: [%d]", requests)
+	}
+}
+
+func TestReplayDeadLetter_NotificationPendingForVideo_Refused(t *testing.T) {
+	store, _ := newDeadLetterStore("", 0)
+	dl, _ := store.add(&nativeCmsMetadataPublicationEvent{UUID: "1234"}, "tid_1", &deliveryError{msg: "failed"})
+	mm := metadataMapper{deadLetters: store, sequencer: newVideoSequencer()}
+	mm.sequencer.register("1234")
+
+	if err := mm.replayDeadLetter(dl, "tid_2"); err != errDeadLetterInProgress {
+		t.Errorf("Expected: [%v]. Actual: [%v]", errDeadLetterInProgress, err)
+	}
+}
+
+func TestDeadLetterStore_LimitReached_OldestDropped(t *testing.T) {
+	store, _ := newDeadLetterStore("", 2)
+	first, _ := store.add(&nativeCmsMetadataPublicationEvent{UUID: "1"}, "tid_1", &deliveryError{msg: "failed"})
+	store.add(&nativeCmsMetadataPublicationEvent{UUID: "2"}, "tid_2", &deliveryError{msg: "failed"})
+	store.add(&nativeCmsMetadataPublicationEvent{UUID: "3"}, "tid_3", &deliveryError{msg: "failed"})
+
+	dls := store.list()
+	if len(dls) != 2 {
+		t.Fatalf("Expected dead letters: [2]. Actual: [%d]", len(dls))
+	}
+	if _, present := store.get(first.ID); present {
+		t.Errorf("Expected the oldest dead letter [%s] to be dropped", first.ID)
+	}
+}
+
+func TestHandleReplayDeadLetters_OlderAndNewerForSameVideo_OnlyNewestReplayed(t *testing.T) {
+	var sent []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var ev nativeCmsMetadataPublicationEvent
+		json.NewDecoder(r.Body).Decode(&ev)
+		sent = append(sent, ev.Value)
+	}))
+	defer ts.Close()
+	store, _ := newDeadLetterStore("", 0)
+	old, _ := store.add(&nativeCmsMetadataPublicationEvent{UUID: "1234", Value: "old"}, "tid_1", &deliveryError{msg: "failed"})
+	newer, _ := store.add(&nativeCmsMetadataPublicationEvent{UUID: "1234", Value: "new"}, "tid_2", &deliveryError{msg: "failed"})
+	other, _ := store.add(&nativeCmsMetadataPublicationEvent{UUID: "5678", Value: "other"}, "tid_3", &deliveryError{msg: "failed"})
+	store.entries[newer.ID].Created = old.Created.Add(time.Second)
+	store.entries[other.ID].Created = old.Created.Add(2 * time.Second)
+	mm := metadataMapper{
+		config:      &notifierConfig{cmsMetadataNotifierAddr: ts.URL},
+		client:      &http.Client{},
+		deadLetters: store,
+		sequencer:   newVideoSequencer(),
+	}
+	r := mux.NewRouter()
+	r.HandleFunc("/__dead-letters/replay", mm.handleReplayAllDeadLetters).Methods("POST")
+	r.HandleFunc("/__dead-letters/{id}/replay", mm.handleReplayDeadLetter).Methods("POST")
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("POST", "/__dead-letters/"+old.ID+"/replay", nil))
+	if w.Code != http.StatusConflict || len(sent) != 0 {
+		t.Fatalf("Expected the older dead letter refused. Found: [%d] [%v]", w.Code, sent)
+	}
+	if dl, _ := store.get(newer.ID); dl.Superseded {
+		t.Fatal("Expected the newer dead letter left replayable.")
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("POST", "/__dead-letters/replay", nil))
+	var summary replaySummary
+	if err := json.NewDecoder(w.Body).Decode(&summary); err != nil {
+		t.Fatalf("[%v]", err)
+	}
+	if summary.Replayed != 2 || len(summary.Skipped) != 1 || summary.Skipped[0] != old.ID {
+		t.Errorf("Unexpected replay summary: [%+v]", summary)
+	}
+	if len(sent) != 2 || sent[0] != "new" || sent[1] != "other" {
+		t.Errorf("Expected the newest dead letter of each video sent. Found: [%v]", sent)
+	}
+	if dl, _ := store.get(old.ID); !dl.Superseded {
+		t.Errorf("Expected the older dead letter flagged superseded. Found: [%+v]", dl)
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+type sentRecord struct {
+	UUID string    `json:"uuid"`
+	Hash string    `json:"hash"`
+	Sent time.Time `json:"sent"`
+}
+
+// sentStore remembers a hash of the last metadata successfully sent for each video, appending every change to a log file when a path is configured
+type sentStore struct {
+	sync.Mutex
+	ttl     time.Duration
+	path    string
+	file    *os.File
+	records map[string]sentRecord
+	writes  int
+	now     func() time.Time
+}
+
+func newSentStore(ttl time.Duration, path string) (*sentStore, error) {
+	s := &sentStore{ttl: ttl, path: path, records: make(map[string]sentRecord), now: time.Now}
+	if path == "" {
+		return s, nil
+	}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	if err := s.compact(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// hashEvent covers the value of the event only, the annotations as sent; the UUID is the key of the record and the content
+// type follows the output format, which the value reflects already
+func hashEvent(ev *nativeCmsMetadataPublicationEvent) string {
+	sum := sha256.Sum256([]byte(ev.Value))
+	return hex.EncodeToString(sum[:])
+}
+
+func (s *sentStore) unchanged(uuid string, hash string) bool {
+	s.Lock()
+	defer s.Unlock()
+	rec, present := s.records[uuid]
+	if !present {
+		return false
+	}
+	if s.expired(rec) {
+		delete(s.records, uuid)
+		return false
+	}
+	return rec.Hash == hash
+}
+
+func (s *sentStore) record(uuid string, hash string) error {
+	s.Lock()
+	defer s.Unlock()
+	rec := sentRecord{UUID: uuid, Hash: hash, Sent: s.now().UTC()}
+	s.records[uuid] = rec
+	if s.file == nil {
+		return nil
+	}
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("Marshalling sent record: [%v]", err)
+	}
+	if _, err = s.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("Writing sent records: [%v]", err)
+	}
+	s.writes++
+	if s.writes > 2*len(s.records)+100 {
+		return s.compact()
+	}
+	return nil
+}
+
+func (s *sentStore) expired(rec sentRecord) bool {
+	return s.now().Sub(rec.Sent) > s.ttl
+}
+
+func (s *sentStore) load() error {
+	f, err := os.Open(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("Opening sent records: [%v]", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var rec sentRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			warnLogger.Printf("Skipping unreadable sent record: [%v]", err)
+			continue
+		}
+		s.records[rec.UUID] = rec
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("Reading sent records: [%v]", err)
+	}
+	return nil
+}
+
+// compact rewrites the log with the records which haven't expired yet; must be called with the lock held or before the store is shared
+func (s *sentStore) compact() error {
+	tmpPath := s.path + ".tmp"
+	//the compacted file is opened for appending up front, so the store never has to reopen it after the rename
+	tmp, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("Compacting sent records: [%v]", err)
+	}
+	w := bufio.NewWriter(tmp)
+	for uuid, rec := range s.records {
+		if s.expired(rec) {
+			delete(s.records, uuid)
+			continue
+		}
+		line, _ := json.Marshal(rec)
+		w.Write(append(line, '\n'))
+	}
+	if err = w.Flush(); err == nil {
+		err = tmp.Sync()
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, s.path)
+	}
+	if err != nil {
+		//the original log is left in place and stays open
+		tmp.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf("Compacting sent records: [%v]", err)
+	}
+	if s.file != nil {
+		s.file.Close()
+	}
+	s.file = tmp
+	s.writes = len(s.records)
+	return nil
+}
+
+func (mm *metadataMapper) unchanged(ev *nativeCmsMetadataPublicationEvent) bool {
+	return mm.sent != nil && mm.sent.unchanged(ev.UUID, hashEvent(ev))
+}
+
+func (mm *metadataMapper) recordSent(ev *nativeCmsMetadataPublicationEvent, tid string) {
+	if mm.sent == nil {
+		return
+	}
+	if err := mm.sent.record(ev.UUID, hashEvent(ev)); err != nil {
+		errorLogger.Printf("tid=[%s]. Recording metadata sent for video=[%s]: %v", tid, ev.UUID, err)
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestHandleNotification_UnchangedMetadata_SendSkippedUnlessForced(t *testing.T) {
+	sends := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sends++
+	}))
+	defer ts.Close()
+	sent, _ := newSentStore(time.Hour, "")
+	mm := metadataMapper{
+		config:   &notifierConfig{cmsMetadataNotifierAddr: ts.URL},
+		client:   &http.Client{},
+		mappings: map[string]term{},
+		sent:     sent,
+	}
+	body := `{"uuid" : "1a78d8e7-473d-4e9f-ae2e-7f20a45e31fc", "tags" : ["brazil"]}`
+
+	for _, url := range []string{"/notify", "/notify", "/notify?force=true"} {
+		req, _ := http.NewRequest("POST", url, bytes.NewReader([]byte(body)))
+		w := httptest.NewRecorder()
+		mm.handleNotification(w, req)
+		if w.Code != http.StatusOK {
+			t.Errorf("Expected status code: [%d]. Actual: [%d]", http.StatusOK, w.Code)
+		}
+	}
+	if sends != 2 {
+		t.Errorf("Expected sends: [2]. Actual: [%d]", sends)
+	}
+}
+
+func TestSentStore_ExpiredAndPersistedRecords(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dedupe")
+	if err != nil {
+		t.Fatalf("[%v]", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "sent.log")
+
+	s, err := newSentStore(time.Hour, path)
+	if err != nil {
+		t.Fatalf("Expected no error. Found: [%v]", err)
+	}
+	s.record("1234", "hash_1")
+	s.record("1234", "hash_2")
+
+	reopened, err := newSentStore(time.Hour, path)
+	if err != nil {
+		t.Fatalf("Expected no error. Found: [%v]", err)
+	}
+	if !reopened.unchanged("1234", "hash_2") {
+		t.Error("Expected persisted hash to be found after reopening.")
+	}
+	if reopened.unchanged("1234", "hash_1") {
+		t.Error("Expected only the latest hash to be kept.")
+	}
+
+	reopened.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	if reopened.unchanged("1234", "hash_2") {
+		t.Error("Expected expired hash to be ignored.")
+	}
+}
+
+func TestSentStore_CompactionFails_StoreStillWritable(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dedupe")
+	if err != nil {
+		t.Fatalf("[%v]", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "sent.log")
+
+	s, err := newSentStore(time.Hour, path)
+	if err != nil {
+		t.Fatalf("Expected no error. Found: [%v]", err)
+	}
+	//a non-empty directory in place of the log makes the rename fail
+	os.Remove(path)
+	if err = os.MkdirAll(filepath.Join(path, "blocker"), 0755); err != nil {
+		t.Fatalf("[%v]", err)
+	}
+	if err = s.compact(); err == nil {
+		t.Fatal("Expected compaction to fail")
+	}
+	if err = s.record("1234", "hash_1"); err != nil {
+		t.Errorf("Expected no error. Found: [%v]", err)
+	}
+	if !s.unchanged("1234", "hash_1") {
+		t.Error("Expected the hash to be recorded.")
+	}
+	if _, err = os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("Expected the temporary file to be removed. Found: [%v]", err)
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// fieldMapping maps the values of a Brightcove custom field as tags of a namespace, optionally with a predicate
+type fieldMapping struct {
+	Field     string
+	Namespace string
+	Predicate string
+}
+
+// parseFieldMappings reads a list like "primarySection=section/isPrimarilyClassifiedBy,brand=brand,series", a field
+// without namespace being looked up with its bare value
+func parseFieldMappings(value string) ([]fieldMapping, error) {
+	var fms []fieldMapping
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		kv := strings.SplitN(entry, "=", 2)
+		fm := fieldMapping{Field: strings.TrimSpace(kv[0])}
+		if fm.Field == "" {
+			return nil, fmt.Errorf("Invalid custom field mapping, expected field=namespace/predicate: [%s]", entry)
+		}
+		if len(kv) == 2 {
+			np := strings.SplitN(kv[1], "/", 2)
+			fm.Namespace = strings.ToLower(strings.TrimSpace(np[0]))
+			if len(np) == 2 {
+				fm.Predicate = strings.TrimSpace(np[1])
+				if err := validatePredicate(fm.Predicate); err != nil {
+					return nil, fmt.Errorf("%v in custom field mapping: [%s]", err, entry)
+				}
+			}
+		}
+		fms = append(fms, fm)
+	}
+	return fms, nil
+}
+
+// tag is the tag the value of the field is looked up as
+func (fm fieldMapping) tag(value string) string {
+	if fm.Namespace == "" {
+		return value
+	}
+	return fm.Namespace + ":" + value
+}
+
+// mapFields looks up the values of the configured custom fields like tags; must be called with the read lock held
+func (mm *metadataMapper) mapFields(v video, tid string, a *annotations) []term {
+	if mm.config == nil {
+		return nil
+	}
+	var terms []term
+	for _, fm := range mm.config.fieldMappings {
+		value := strings.TrimSpace(v.CustomFields[fm.Field])
+		if value == "" {
+			continue
+		}
+		tag := fm.tag(value)
+		t, outcome := mm.lookupTag(tag, tid)
+		switch outcome {
+		case tagIgnored:
+			infoLogger.Printf("tid=[%s]. Custom field [%s] value [%s] ignored.", tid, fm.Field, value)
+			a.Ignored = append(a.Ignored, tag)
+			continue
+		case tagUnmapped:
+			infoLogger.Printf("tid=[%s]. Custom field [%s] value [%s] has no TME mapping.", tid, fm.Field, value)
+			a.Unmapped = append(a.Unmapped, tag)
+			continue
+		}
+		t.Provenance.Field = fm.Field
+		if fm.Predicate != "" {
+			t.Predicate = fm.Predicate
+		}
+		terms = append(terms, t)
+	}
+	return terms
+}
+
+// mergeFieldTerms adds the terms of the custom fields to the ones of the tags, the field term winning for the same concept.
+// A primary section given by a field demotes the ones given by tags.
+func mergeFieldTerms(tagTerms []term, fieldTerms []term) []term {
+	if len(fieldTerms) == 0 {
+		return tagTerms
+	}
+	byID := make(map[string]term)
+	primary := false
+	for _, t := range fieldTerms {
+		if _, present := byID[t.ID]; !present {
+			byID[t.ID] = t
+		}
+		primary = primary || t.Predicate == predicateIsPrimarilyClassifiedBy
+	}
+	var merged []term
+	for _, t := range tagTerms {
+		if ft, present := byID[t.ID]; present {
+			merged = append(merged, ft)
+			delete(byID, t.ID)
+			continue
+		}
+		if primary && t.Predicate == predicateIsPrimarilyClassifiedBy {
+			t.Predicate = predicateIsClassifiedBy
+		}
+		merged = append(merged, t)
+	}
+	for _, t := range fieldTerms {
+		if _, present := byID[t.ID]; present {
+			merged = append(merged, t)
+			delete(byID, t.ID)
+		}
+	}
+	return merged
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseFieldMappings(t *testing.T) {
+	fms, err := parseFieldMappings("primarySection=section/isPrimarilyClassifiedBy, brand=Brand, series")
+	if err != nil {
+		t.Fatalf("Expected no error. Found: [%v]", err)
+	}
+	expected := []fieldMapping{
+		{Field: "primarySection", Namespace: "section", Predicate: predicateIsPrimarilyClassifiedBy},
+		{Field: "brand", Namespace: "brand"},
+		{Field: "series"},
+	}
+	if len(fms) != len(expected) {
+		t.Fatalf("Unexpected field mappings: [%+v]", fms)
+	}
+	for i := range expected {
+		if fms[i] != expected[i] {
+			t.Errorf("Expected: [%+v]. Actual: [%+v]", expected[i], fms[i])
+		}
+	}
+	if _, err = parseFieldMappings("primarySection=section/primary"); err == nil {
+		t.Error("Expected error for an unknown predicate.")
+	}
+}
+
+func TestAnnotate_PrimarySectionField_DrivesPrimarySection(t *testing.T) {
+	mm := metadataMapper{
+		config: &notifierConfig{fieldMappings: []fieldMapping{
+			{Field: "primarySection", Namespace: "section", Predicate: predicateIsPrimarilyClassifiedBy},
+			{Field: "brand", Namespace: "brand"},
+		}},
+		mappings: map[string]term{
+			"section:world":     {CanonicalName: "World", ID: "MQ==-U2VjdGlvbnM=", Taxonomy: "Sections", Predicate: predicateIsClassifiedBy},
+			"section:companies": {CanonicalName: "Companies", ID: "Mjk=-U2VjdGlvbnM=", Taxonomy: "Sections", Predicate: predicateIsPrimarilyClassifiedBy},
+		},
+	}
+	v := video{
+		UUID:         "1234",
+		Tags:         []string{"section:world", "section:companies"},
+		CustomFields: map[string]string{"primarySection": "World", "brand": "Lex", "byline": "John Authers"},
+	}
+
+	a := mm.annotate(v, "tid_test")
+
+	if len(a.Terms) != 2 {
+		t.Fatalf("Expected the field term merged with the tag one. Found: [%+v]", a.Terms)
+	}
+	if a.Terms[0].ID != "MQ==-U2VjdGlvbnM=" || a.Terms[0].Predicate != predicateIsPrimarilyClassifiedBy || a.Terms[0].Provenance.Field != "primarySection" {
+		t.Errorf("Expected World primary from the field. Found: [%+v]", a.Terms[0])
+	}
+	if a.Terms[1].Predicate != predicateIsClassifiedBy {
+		t.Errorf("Expected the primary section of the tags demoted. Found: [%+v]", a.Terms[1])
+	}
+	if len(a.Unmapped) != 1 || a.Unmapped[0] != "brand:Lex" {
+		t.Errorf("Expected the unmapped field value. Found: [%v]", a.Unmapped)
+	}
+
+	payload, err := contentRefFormatter{}.format(v.UUID, a.Terms)
+	if err != nil {
+		t.Fatalf("[%v]", err)
+	}
+	if !strings.Contains(string(payload), `<primarySection taxonomy="Sections" id="MQ==-U2VjdGlvbnM="><canonicalName>World</canonicalName></primarySection>`) {
+		t.Errorf("Expected World as primary section. Found: [%s]", payload)
+	}
+}
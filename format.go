@@ -0,0 +1,161 @@
+package main
+
+import (
+	"crypto/md5"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"strings"
+)
+
+const (
+	formatXML  = "xml"
+	formatJSON = "json"
+)
+
+const (
+	thingsURL               = "http://api.ft.com/things/"
+	tmeAuthority            = "http://api.ft.com/system/FT-TME"
+	relevanceScoringSystem  = "http://api.ft.com/scoringsystem/FT-RELEVANCE-SYSTEM"
+	confidenceScoringSystem = "http://api.ft.com/scoringsystem/FT-CONFIDENCE-SYSTEM"
+)
+
+// metadataFormatter turns the terms of a video into the payload of the metadata publish event
+type metadataFormatter interface {
+	format(uuid string, terms []term) ([]byte, error)
+	contentType() string
+}
+
+// newFormatter builds the formatter of the given format; conceptIDs tells whether the UPP UUIDs of the terms go alongside or instead of their TME IDs,
+// tagPredicates whether the XML tags get a predicate attribute
+func newFormatter(name string, conceptIDs string, tagPredicates bool) (metadataFormatter, error) {
+	switch conceptIDs {
+	case "", conceptIDsAlongside, conceptIDsInstead:
+	default:
+		return nil, fmt.Errorf("Unknown concept IDs mode: [%s]", conceptIDs)
+	}
+	switch name {
+	case "", formatXML:
+		return contentRefFormatter{replaceTMEIDs: conceptIDs == conceptIDsInstead, tagPredicates: tagPredicates}, nil
+	case formatJSON:
+		return uppAnnotationsFormatter{omitTMEIDs: conceptIDs == conceptIDsInstead}, nil
+	}
+	return nil, fmt.Errorf("Unknown output format: [%s]", name)
+}
+
+// contentRefFormatter produces the legacy contentRef XML
+type contentRefFormatter struct {
+	replaceTMEIDs bool
+	tagPredicates bool
+}
+
+func (f contentRefFormatter) format(uuid string, terms []term) ([]byte, error) {
+	if f.replaceTMEIDs {
+		replaced := make([]term, len(terms))
+		for i, t := range terms {
+			if t.UUID != "" {
+				t.ID, t.UUID = t.UUID, ""
+			}
+			replaced[i] = t
+		}
+		terms = replaced
+	}
+	marshalled, err := xml.Marshal(buildContentRef(terms, f.tagPredicates))
+	if err != nil {
+		return nil, fmt.Errorf("XML Marshalling: [%v]", err)
+	}
+	return marshalled, nil
+}
+
+// the legacy events were sent without content type
+func (contentRefFormatter) contentType() string {
+	return ""
+}
+
+type uppAnnotations struct {
+	UUID        string          `json:"uuid"`
+	Annotations []uppAnnotation `json:"annotations"`
+}
+
+type uppAnnotation struct {
+	Thing       uppThing        `json:"thing"`
+	Provenances []uppProvenance `json:"provenances"`
+}
+
+type uppThing struct {
+	ID          string          `json:"id"`
+	PrefLabel   string          `json:"prefLabel"`
+	Predicate   string          `json:"predicate"`
+	Type        string          `json:"type,omitempty"`
+	Identifiers []uppIdentifier `json:"identifiers"`
+}
+
+type uppIdentifier struct {
+	Authority       string `json:"authority"`
+	IdentifierValue string `json:"identifierValue"`
+}
+
+type uppProvenance struct {
+	Scores []uppScore `json:"scores"`
+}
+
+type uppScore struct {
+	ScoringSystem string  `json:"scoringSystem"`
+	Value         float64 `json:"value"`
+}
+
+// uppAnnotationsFormatter produces the UPP JSON annotations model
+type uppAnnotationsFormatter struct {
+	omitTMEIDs bool
+}
+
+func (f uppAnnotationsFormatter) format(uuid string, terms []term) ([]byte, error) {
+	doc := uppAnnotations{UUID: uuid, Annotations: []uppAnnotation{}}
+	for _, t := range terms {
+		score := scoreOf(t)
+		thing := uppThing{
+			ID:          thingsURL + t.UUID,
+			PrefLabel:   t.CanonicalName,
+			Predicate:   predicateOf(t),
+			Type:        t.Type,
+			Identifiers: []uppIdentifier{},
+		}
+		if t.UUID == "" {
+			thing.ID = thingsURL + conceptUUID(t.ID)
+		}
+		if !f.omitTMEIDs || t.UUID == "" {
+			thing.Identifiers = append(thing.Identifiers, uppIdentifier{Authority: tmeAuthority, IdentifierValue: t.ID})
+		}
+		doc.Annotations = append(doc.Annotations, uppAnnotation{
+			Thing: thing,
+			Provenances: []uppProvenance{{Scores: []uppScore{
+				{ScoringSystem: relevanceScoringSystem, Value: float64(score.Relevance) / 100},
+				{ScoringSystem: confidenceScoringSystem, Value: float64(score.Confidence) / 100},
+			}}},
+		})
+	}
+	marshalled, err := json.Marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("JSON Marshalling annotations: [%v]", err)
+	}
+	return marshalled, nil
+}
+
+func (uppAnnotationsFormatter) contentType() string {
+	return "application/vnd.ft-upp-annotations+json"
+}
+
+// conceptUUID derives the UPP UUID of a TME concept without concordance, a name based (version 3) UUID of its TME ID
+func conceptUUID(tmeID string) string {
+	b := md5.Sum([]byte(tmeID))
+	b[6] = (b[6] & 0x0f) | 0x30
+	b[8] = (b[8] & 0x3f) | 0x80
+	return strings.ToLower(fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]))
+}
+
+func (mm *metadataMapper) formatter() metadataFormatter {
+	if mm.format == nil {
+		return contentRefFormatter{}
+	}
+	return mm.format
+}
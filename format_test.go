@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestUppAnnotationsFormatter_AnnotationsMatchTerms(t *testing.T) {
+	terms := []term{
+		{CanonicalName: "Emerging-Markets", ID: "MTA2-U2VjdGlvbnM=", Taxonomy: "Sections"},
+		{CanonicalName: "John Authers", ID: "Q0ItMDAwMDkyMw==-QXV0aG9ycw==", Taxonomy: "Authors"},
+	}
+
+	payload, err := uppAnnotationsFormatter{}.format("1234", terms)
+	if err != nil {
+		t.Fatalf("Expected no error. Found: [%v]", err)
+	}
+	var actual uppAnnotations
+	if err = json.Unmarshal(payload, &actual); err != nil {
+		t.Fatalf("[%v]", err)
+	}
+
+	if actual.UUID != "1234" || len(actual.Annotations) != 2 {
+		t.Fatalf("Unexpected annotations: [%+v]", actual)
+	}
+	section := actual.Annotations[0]
+	if section.Thing.ID != thingsURL+conceptUUID("MTA2-U2VjdGlvbnM=") || section.Thing.PrefLabel != "Emerging-Markets" {
+		t.Errorf("Unexpected thing: [%+v]", section.Thing)
+	}
+	if section.Thing.Predicate != predicateIsClassifiedBy || actual.Annotations[1].Thing.Predicate != predicateMentions {
+		t.Errorf("Unexpected predicates: [%s] [%s]", section.Thing.Predicate, actual.Annotations[1].Thing.Predicate)
+	}
+	if len(section.Thing.Identifiers) != 1 || section.Thing.Identifiers[0].IdentifierValue != "MTA2-U2VjdGlvbnM=" {
+		t.Errorf("Unexpected identifiers: [%+v]", section.Thing.Identifiers)
+	}
+	if len(section.Provenances) != 1 || len(section.Provenances[0].Scores) != 2 || section.Provenances[0].Scores[0].Value != 0.9 {
+		t.Errorf("Unexpected provenances: [%+v]", section.Provenances)
+	}
+}
+
+func TestConceptUUID_DeterministicVersion3UUID(t *testing.T) {
+	actual := conceptUUID("MTA2-U2VjdGlvbnM=")
+	if actual != conceptUUID("MTA2-U2VjdGlvbnM=") {
+		t.Error("Expected the same UUID for the same TME ID.")
+	}
+	if len(actual) != 36 || actual[14] != '3' {
+		t.Errorf("Expected a version 3 UUID. Actual: [%s]", actual)
+	}
+	if actual == conceptUUID("MTA1-U2VjdGlvbnM=") {
+		t.Error("Expected different UUIDs for different TME IDs.")
+	}
+}
+
+func TestNewFormatter_UnknownFormat_ErrorReturned(t *testing.T) {
+	if _, err := newFormatter("yaml", "", false); err == nil {
+		t.Error("Expected error.")
+	}
+}
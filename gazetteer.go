@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
+)
+
+const ruleGazetteer = "gazetteer"
+
+// namespaces of the tags the gazetteer is consulted for, besides the tags without namespace
+var geoNamespaces = map[string]bool{"region": true, "regions": true, "country": true, "location": true, "place": true}
+
+var placeSeparators = regexp.MustCompile(`[\s.]+`)
+
+// gazetteer recognises the names, demonyms and ISO codes of the countries whose Regions concept is configured
+type gazetteer struct {
+	names map[string]string
+	codes map[string]string
+	terms map[string]term
+}
+
+// loadGazetteer reads the TME ID of each country from a JSON file like {"GB":"...","BR":"..."}
+func loadGazetteer(path string) (*gazetteer, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Reading gazetteer: [%v]", err)
+	}
+	var ids map[string]string
+	if err = json.Unmarshal(data, &ids); err != nil {
+		return nil, fmt.Errorf("Decoding gazetteer: [%v]", err)
+	}
+	return newGazetteer(ids)
+}
+
+func newGazetteer(ids map[string]string) (*gazetteer, error) {
+	g := &gazetteer{names: make(map[string]string), codes: make(map[string]string), terms: make(map[string]term)}
+	known := make(map[string]bool)
+	for _, c := range countries {
+		known[c.Code] = true
+		id, present := ids[c.Code]
+		if !present {
+			continue
+		}
+		taxonomy, err := decodeTaxonomy(id)
+		if err != nil {
+			return nil, err
+		}
+		if taxonomy != "Regions" {
+			return nil, fmt.Errorf("Gazetteer ID of [%s] isn't a Regions concept: [%s] is in [%s]", c.Code, id, taxonomy)
+		}
+		g.terms[c.Code] = term{CanonicalName: c.Names[0], ID: id, Taxonomy: taxonomy}
+		g.codes[c.Code] = c.Code
+		for _, name := range append(append([]string{}, c.Names...), c.Demonyms...) {
+			g.names[placeName(name)] = c.Code
+		}
+	}
+	for code := range ids {
+		if !known[code] {
+			return nil, fmt.Errorf("Unknown country code in gazetteer: [%s]", code)
+		}
+	}
+	return g, nil
+}
+
+// placeName normalises a place for the lookup: lower case, without dots nor leading "the", e.g. "The U.K." is "uk"
+func placeName(name string) string {
+	name = strings.TrimSpace(placeSeparators.ReplaceAllString(strings.ToLower(name), " "))
+	return strings.Replace(strings.TrimPrefix(name, "the "), " ", "", -1)
+}
+
+// lookup returns the term of the country the tag names. ISO codes only match in upper case and in a geographical
+// namespace, so that "region:IT" is Italy but "it" and "IS" aren't, and so do ambiguous names like "Jordan".
+func (g *gazetteer) lookup(tag string) (term, string, bool) {
+	parsed := parseTag(tag)
+	if parsed.Namespace != "" && !geoNamespaces[parsed.Namespace] {
+		return term{}, "", false
+	}
+	name := placeName(parsed.Value)
+	if parsed.Namespace == "" && ambiguousPlaces[name] {
+		return term{}, "", false
+	}
+	code, present := g.names[name]
+	if !present && parsed.Namespace != "" {
+		//bare codes are too often something else, e.g. IS for Islamic State
+		code, present = g.codes[parsed.Value]
+	}
+	if !present {
+		return term{}, "", false
+	}
+	return g.terms[code], code, true
+}
+
+// placeTerm looks the tag up in the gazetteer; must be called with the read lock held
+func (mm *metadataMapper) placeTerm(tag string) (term, bool) {
+	if mm.gazetteer == nil {
+		return term{}, false
+	}
+	t, code, present := mm.gazetteer.lookup(tag)
+	if !present {
+		return term{}, false
+	}
+	if mm.config != nil {
+		applyDefaultPredicate(&t, mm.config.defaultPredicates)
+	}
+	t = withProvenance(t, tag, code, ruleGazetteer)
+	t.Provenance.MappingVersion = mm.mappingVersion
+	return t, true
+}
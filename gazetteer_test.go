@@ -0,0 +1,85 @@
+package main
+
+import "testing"
+
+func TestGazetteer_Lookup_NamesDemonymsAndCodes(t *testing.T) {
+	g, err := newGazetteer(map[string]string{"GB": "VUs=-UmVnaW9ucw==", "IT": "SVQ=-UmVnaW9ucw==", "TH": "VEg=-UmVnaW9ucw==", "US": "VVM=-UmVnaW9ucw==", "JO": "Sk8=-UmVnaW9ucw=="})
+	if err != nil {
+		t.Fatalf("Expected no error. Found: [%v]", err)
+	}
+	var testCases = []struct {
+		tag     string
+		code    string
+		matched bool
+	}{
+		{"UK", "GB", true},
+		{"United Kingdom", "GB", true},
+		{"the U.K.", "GB", true},
+		{"britain", "GB", true},
+		{"British", "GB", true},
+		{"region:Great  Britain", "GB", true},
+		{"GB", "", false},
+		{"region:GB", "GB", true},
+		{"gb", "", false},
+		{"IT", "", false},
+		{"country:IT", "IT", true},
+		{"country:it", "", false},
+		{"Thailand", "TH", true},
+		{"section:UK", "", false},
+		{"France", "", false},
+		{"US", "", false},
+		{"location:US", "US", true},
+		{"us", "", false},
+		{"America", "", false},
+		{"country:America", "US", true},
+		{"Jordan", "", false},
+		{"region:Jordan", "JO", true},
+		{"Jordanian", "JO", true},
+	}
+	for _, tc := range testCases {
+		actual, code, matched := g.lookup(tc.tag)
+		if matched != tc.matched || code != tc.code {
+			t.Errorf("Unexpected lookup of [%s]: [%s] [%t]", tc.tag, code, matched)
+		}
+		if matched && actual.Taxonomy != "Regions" {
+			t.Errorf("Expected a Regions term for [%s]. Found: [%+v]", tc.tag, actual)
+		}
+	}
+	if uk, _, _ := g.lookup("Britain"); uk.CanonicalName != "United Kingdom" {
+		t.Errorf("Expected the canonical name of the country. Found: [%s]", uk.CanonicalName)
+	}
+}
+
+func TestNewGazetteer_UnknownCode_ErrorReturned(t *testing.T) {
+	if _, err := newGazetteer(map[string]string{"XX": "WFg=-UmVnaW9ucw=="}); err == nil {
+		t.Error("Expected error.")
+	}
+}
+
+func TestNewGazetteer_IDOutsideRegions_ErrorReturned(t *testing.T) {
+	if _, err := newGazetteer(map[string]string{"GB": "VUs=-U2VjdGlvbnM="}); err == nil {
+		t.Error("Expected error.")
+	}
+}
+
+func TestAnnotate_SheetMatchFirstThenGazetteer(t *testing.T) {
+	g, _ := newGazetteer(map[string]string{"GB": "VUs=-UmVnaW9ucw==", "BR": "QnJhemls-UmVnaW9ucw=="})
+	mm := metadataMapper{
+		config:    &notifierConfig{},
+		mappings:  map[string]term{"brazil": {CanonicalName: "Brazil", ID: "QnJhemlsMg==-UmVnaW9ucw==", Taxonomy: "Regions"}},
+		gazetteer: g,
+	}
+
+	a := mm.annotate(video{UUID: "1234", Tags: []string{"Brazil", "Britain"}}, "tid_test")
+
+	if len(a.Terms) != 2 || len(a.Unmapped) != 0 {
+		t.Fatalf("Unexpected annotations: [%+v]", a)
+	}
+	if a.Terms[0].ID != "QnJhemlsMg==-UmVnaW9ucw==" || a.Terms[0].Provenance.Rule != ruleExact {
+		t.Errorf("Expected the sheet mapping first. Found: [%+v]", a.Terms[0])
+	}
+	uk := a.Terms[1]
+	if uk.ID != "VUs=-UmVnaW9ucw==" || uk.Predicate != predicateMentions || uk.Provenance.Rule != ruleGazetteer || uk.Provenance.Key != "GB" {
+		t.Errorf("Unexpected gazetteer term: [%+v] [%+v]", uk, uk.Provenance)
+	}
+}
@@ -4,56 +4,208 @@ import (
 	"bytes"
 	"encoding/base64"
 	"encoding/json"
-	"encoding/xml"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/Financial-Times/transactionid-utils-go"
-	"strings"
+	"github.com/gorilla/mux"
 )
 
 type video struct {
-	UUID string
-	Tags []string
+	UUID         string
+	Tags         []string
+	CustomFields map[string]string `json:"custom_fields,omitempty"`
 }
 
 type nativeCmsMetadataPublicationEvent struct {
-	Value string `json:"value"`
-	UUID  string `json:"uuid"`
+	Value       string `json:"value"`
+	UUID        string `json:"uuid"`
+	ContentType string `json:"contentType,omitempty"`
 }
 
 var defaultTagScore = tagScore{Confidence: 90, Relevance: 90}
 
+func scoreOf(t term) tagScore {
+	if t.Score != nil {
+		return *t.Score
+	}
+	return defaultTagScore
+}
+
+// rules recorded in the provenance of the terms
+const (
+	ruleExact      = "exact"
+	ruleSuggestion = "suggestion"
+)
+
+// how much of an error response from cms-metadata-notifier is kept for diagnosis
+const maxResponseBodyKept = 4096
+
 func (mm *metadataMapper) handleNotification(w http.ResponseWriter, r *http.Request) {
 	tid := transactionidutils.GetTransactionIDFromRequest(r)
 	infoLogger.Printf("Received video. tid=[%s]", tid)
+	v, ok := decodeVideo(w, r, tid)
+	if !ok {
+		return
+	}
+	if r.URL.Query().Get("dryRun") == "true" {
+		mm.preview(w, r, v, tid)
+		return
+	}
+	mm.rememberVideo(v, tid)
+	resp, err := mm.publish(v, tid, r.URL.Query().Get("force") == "true")
+	if err != nil {
+		publishErr(w, tid, v.UUID, err)
+		return
+	}
+	status := http.StatusOK
+	if resp.Result == resultQueued {
+		status = http.StatusAccepted
+	}
+	writeJSON(w, status, resp)
+}
+
+// concordanceFailure tells a failed concordance lookup apart among the errors of publish
+type concordanceFailure struct {
+	error
+}
+
+// publish maps the video, records its audit, unmapped tags and mapping hits, then sends its metadata event unless it
+// didn't change since last sent and the send isn't forced. The comparison is made in turn with the other sends of the
+// video, so that a notification restoring the tags of the last one sent still overrides a newer one in flight.
+func (mm *metadataMapper) publish(v video, tid string, force bool) (notifyResponse, error) {
+	a := mm.annotate(v, tid)
+	var err error
+	if a.Terms, err = mm.resolveConcepts(a.Terms, tid); err != nil {
+		return notifyResponse{}, concordanceFailure{err}
+	}
+	ev, err := newMetadataPublishEvent(mm.formatter(), v.UUID, a.Terms, tid)
+	if err != nil {
+		return notifyResponse{}, err
+	}
+	mm.recordAudit(v.UUID, tid, a)
+	mm.recordUnmapped(v.UUID, a.Unmapped)
+	mm.recordIgnored(a.Ignored)
+	mm.recordHits(a.Terms)
+	resp := newNotifyResponse(v.UUID, tid, a)
+	if mm.queue != nil {
+		if resp.ID, err = mm.submit(ev, tid, force); err != nil {
+			return notifyResponse{}, err
+		}
+		resp.Result = resultQueued
+		return resp, nil
+	}
+	if resp.Result, err = mm.sendInOrder(ev, tid, mm.register(v.UUID), force); err != nil {
+		return notifyResponse{}, err
+	}
+	switch resp.Result {
+	case resultSuperseded:
+		infoLogger.Printf("Skipped video=[%s], a newer notification for it was received. tid=[%s]", v.UUID, tid)
+	case resultNoChange:
+		infoLogger.Printf("Skipped video=[%s], its metadata didn't change since last sent. tid=[%s]", v.UUID, tid)
+	default:
+		infoLogger.Printf("Sent metadata event for video=[%s] tid=[%s]", v.UUID, tid)
+	}
+	return resp, nil
+}
+
+func decodeVideo(w http.ResponseWriter, r *http.Request, tid string) (video, bool) {
 	var v video
 	err := json.NewDecoder(r.Body).Decode(&v)
 	if err != nil {
-		handleServerErr(w, fmt.Sprintf("tid=[%s]. Cannot decode video metadata: [%v]", tid, err))
-		return
+		clientErr(w, tid, fmt.Sprintf("Cannot decode video metadata: [%v]", err))
+		return v, false
 	}
 	if v.UUID == "" {
-		handleClientErr(w, fmt.Sprintf("tid=[%s]. Missing uuid: [%#v]", tid, v))
-		return
+		clientErr(w, tid, fmt.Sprintf("Missing uuid: [%#v]", v))
+		return v, false
 	}
-	ev, err := mm.createMetadataPublishEventMsg(v, tid)
+	return v, true
+}
+
+// submit hands the event over to the workers, returning the tracking id of the notification
+func (mm *metadataMapper) submit(ev *nativeCmsMetadataPublicationEvent, tid string, force bool) (string, error) {
+	id, err := newTrackingID()
 	if err != nil {
-		handleServerErr(w, fmt.Sprintf("tid=[%s]. %v", tid, err))
+		return "", err
+	}
+	if mm.outbox != nil {
+		if err = mm.outbox.put(id, tid, ev); err != nil {
+			return "", err
+		}
+	}
+	n := newNotification(id, tid, ev)
+	n.force = force
+	n.seq = mm.register(ev.UUID)
+	if mm.debouncer != nil {
+		mm.queue.hold(n)
+		if replaced := mm.debouncer.submit(n); replaced != nil {
+			mm.supersede(replaced)
+		}
+		infoLogger.Printf("Holding video=[%s] as notification=[%s] for [%v] tid=[%s]", ev.UUID, id, mm.debouncer.window, tid)
+		return id, nil
+	}
+	if err = mm.queue.enqueue(n); err != nil {
+		if mm.sequencer != nil {
+			mm.sequencer.discard(ev.UUID)
+		}
+		mm.ackOutbox(n)
+		return "", err
+	}
+	infoLogger.Printf("Queued video=[%s] as notification=[%s] tid=[%s]", ev.UUID, id, tid)
+	return id, nil
+}
+
+func (mm *metadataMapper) handleNotificationStatus(w http.ResponseWriter, r *http.Request) {
+	tid := transactionidutils.GetTransactionIDFromRequest(r)
+	id := mux.Vars(r)["id"]
+	if mm.queue == nil {
+		notFoundErr(w, tid, fmt.Sprintf("Status requested for notification=[%s] while async mode is off", id))
+		return
+	}
+	n, present := mm.queue.status(id)
+	if !present {
+		notFoundErr(w, tid, fmt.Sprintf("Unknown notification=[%s]", id))
 		return
 	}
+	writeJSON(w, http.StatusOK, n)
+}
+
+// deliver sends a new event for the video, dead lettering it on failure. Once it's delivered, the dead letters of the
+// video stored before are stale.
+func (mm *metadataMapper) deliver(ev *nativeCmsMetadataPublicationEvent, tid string) error {
+	started := time.Now().UTC()
+	err := mm.send(ev, tid)
+	if mm.deadLetters == nil {
+		return err
+	}
+	if err == nil {
+		mm.supersedeDeadLetters(ev.UUID, started, tid)
+		return nil
+	}
+	if mm.deadLetter(ev, tid, err) {
+		if de, ok := err.(*deliveryError); ok {
+			de.deadLettered = true
+		}
+	}
+	return err
+}
+
+func (mm *metadataMapper) send(ev *nativeCmsMetadataPublicationEvent, tid string) error {
 	m, err := json.Marshal(*ev)
 	if err != nil {
-		handleServerErr(w, fmt.Sprintf("tid=[%s]. JSON Marshalling: [%v]", tid, err))
-		return
+		return fmt.Errorf("JSON Marshalling: [%v]", err)
 	}
 	if err = mm.sendMetadata(m, tid); err != nil {
-		handleServerErr(w, fmt.Sprintf("tid=[%s]. %v", tid, err))
-		return
+		return err
 	}
-	infoLogger.Printf("Sent metadata event for video=[%s] tid=[%s]", v.UUID, tid)
+	mm.recordSent(ev, tid)
+	return nil
 }
 
 func (mm *metadataMapper) handleReload(w http.ResponseWriter, r *http.Request) {
@@ -62,53 +214,195 @@ func (mm *metadataMapper) handleReload(w http.ResponseWriter, r *http.Request) {
 			w.WriteHeader(http.StatusInternalServerError)
 		}
 	}()
-	mm.loadMappings()
+	writeJSON(w, http.StatusOK, mm.loadMappings())
 }
 
 func (mm *metadataMapper) createMetadataPublishEventMsg(v video, tid string) (*nativeCmsMetadataPublicationEvent, error) {
-	marshalled, err := xml.Marshal(buildContentRef(mm.getAnnotations(v.Tags, tid)))
+	terms, err := mm.resolveConcepts(mm.annotate(v, tid).Terms, tid)
 	if err != nil {
-		return nil, fmt.Errorf("tid=[%s]. XML Marshalling: [%v]", tid, err)
+		return nil, fmt.Errorf("tid=[%s]. %v", tid, err)
+	}
+	return newMetadataPublishEvent(mm.formatter(), v.UUID, terms, tid)
+}
+
+func newMetadataPublishEvent(f metadataFormatter, uuid string, terms []term, tid string) (*nativeCmsMetadataPublicationEvent, error) {
+	marshalled, err := f.format(uuid, terms)
+	if err != nil {
+		return nil, fmt.Errorf("tid=[%s]. %v", tid, err)
 	}
 	return &nativeCmsMetadataPublicationEvent{
-		Value: base64.StdEncoding.EncodeToString(marshalled),
-		UUID:  v.UUID,
+		Value:       base64.StdEncoding.EncodeToString(marshalled),
+		UUID:        uuid,
+		ContentType: f.contentType(),
 	}, nil
 }
 
-func buildContentRef(terms []term) contentRef {
+// buildContentRef only adds the predicate attribute to the tags when asked to, the legacy consumers not expecting it
+func buildContentRef(terms []term, withPredicates bool) contentRef {
 	var tagz []tag
+	var primarySection term
 
 	for _, term := range terms {
-		tagz = append(tagz, tag{Term: term, TagScore: defaultTagScore})
+		t := tag{Term: term, TagScore: scoreOf(term)}
+		if withPredicates {
+			t.Predicate = term.Predicate
+		}
+		tagz = append(tagz, t)
+		if term.Predicate == predicateIsPrimarilyClassifiedBy && primarySection.ID == "" {
+			primarySection = term
+		}
 	}
 
 	return contentRef{
-		TagHolder: tags{Tags: tagz},
+		TagHolder:      tags{Tags: tagz},
+		PrimarySection: primarySection,
 	}
 }
 
-func (mm *metadataMapper) getAnnotations(tags []string, tid string) []term {
-	var annotations []term
+type annotations struct {
+	Terms    []term   `json:"terms"`
+	Unmapped []string `json:"unmappedTags"`
+	Ignored  []string `json:"ignoredTags"`
+}
+
+// outcomes of looking a tag up
+type tagLookup int
 
+const (
+	tagMapped tagLookup = iota
+	tagIgnored
+	tagUnmapped
+)
+
+// annotate maps the tags and custom fields of the video, expands them, then applies its override
+func (mm *metadataMapper) annotate(v video, tid string) annotations {
 	mm.RLock()
-	defer mm.RUnlock()
+	a := mm.mapTags(v.Tags, tid)
+	a.Terms = mergeFieldTerms(a.Terms, mm.mapFields(v, tid, &a))
+	a.Terms = mm.expand(a.Terms)
+	mm.RUnlock()
+	if mm.overrides == nil {
+		return a
+	}
+	if o, present := mm.overrides.get(v.UUID); present {
+		infoLogger.Printf("tid=[%s]. Applying the override of video=[%s]", tid, v.UUID)
+		a.Terms = o.apply(a.Terms)
+	}
+	return a
+}
 
+// lookupTag runs a tag through the ignore rules, the mappings, the person names, the gazetteer and the auto applied
+// suggestions, in that order; must be called with the read lock held
+func (mm *metadataMapper) lookupTag(tag string, tid string) (term, tagLookup) {
+	if mm.ignored(tag) {
+		return term{}, tagIgnored
+	}
+	key := tagKey(tag)
+	if t, present := mm.mappings[key]; present {
+		return withProvenance(t, tag, key, ruleExact), tagMapped
+	}
+	if t, personKey, present := mm.personTerm(tag); present {
+		return withProvenance(t, tag, personKey, ruleExact), tagMapped
+	}
+	if place, ok := mm.placeTerm(tag); ok {
+		infoLogger.Printf("tid=[%s]. Tag [%s] mapped through the gazetteer to [%s].", tid, tag, place.CanonicalName)
+		return place, tagMapped
+	}
+	if suggested, suggestedKey, ok := mm.autoApplied(tag); ok {
+		infoLogger.Printf("tid=[%s]. Tag [%s] mapped through the suggested mapping [%s].", tid, tag, suggestedKey)
+		return withProvenance(suggested, tag, suggestedKey, ruleSuggestion), tagMapped
+	}
+	return term{}, tagUnmapped
+}
+
+// mapTags must be called with the read lock held
+func (mm *metadataMapper) mapTags(tags []string, tid string) annotations {
+	var a annotations
 	for _, tag := range tags {
-		t, present := mm.mappings[strings.ToLower(tag)]
-		if !present {
+		t, outcome := mm.lookupTag(tag, tid)
+		switch outcome {
+		case tagIgnored:
+			infoLogger.Printf("tid=[%s]. Brightcove tag [%s] ignored.", tid, tag)
+			a.Ignored = append(a.Ignored, tag)
+		case tagUnmapped:
 			infoLogger.Printf("tid=[%s]. Brightcove tag [%s] has no TME mapping.", tid, tag)
-			continue
+			a.Unmapped = append(a.Unmapped, tag)
+		default:
+			a.Terms = append(a.Terms, t)
 		}
-		annotations = append(annotations, t)
 	}
-	return annotations
+	return a
+}
+
+// withProvenance copies the term, recording how the tag was matched on top of the sheet row it comes from
+func withProvenance(t term, tag string, key string, rule string) term {
+	p := provenance{}
+	if t.Provenance != nil {
+		p = *t.Provenance
+	}
+	p.SourceTag = tag
+	p.Key = key
+	p.Rule = rule
+	t.Provenance = &p
+	return t
 }
 
 func (mm *metadataMapper) sendMetadata(metadata []byte, tid string) error {
+	for attempt := 1; ; attempt++ {
+		if mm.breaker != nil {
+			if err := mm.breaker.allow(); err != nil {
+				return &deliveryError{msg: err.Error(), circuitOpen: true}
+			}
+		}
+		err := mm.sendMetadataAttempt(metadata, tid)
+		mm.recordOutcome(err)
+		if err == nil {
+			if attempt > 1 {
+				infoLogger.Printf("tid=[%s]. Metadata sent on attempt [%d]", tid, attempt)
+			}
+			return nil
+		}
+		if !err.retryable || attempt > mm.config.maxRetries {
+			if attempt > 1 {
+				warnLogger.Printf("tid=[%s]. Giving up sending metadata after [%d] attempts", tid, attempt)
+			}
+			return err
+		}
+		delay := backoff(attempt, mm.config.retryInitialBackoff, mm.config.retryMaxBackoff)
+		if err.retryAfter > delay {
+			//a Retry-After is honoured up to the configured cap, so one response can't stall a worker for hours
+			delay = err.retryAfter
+			if delay > mm.config.retryMaxBackoff {
+				delay = mm.config.retryMaxBackoff
+			}
+		}
+		warnLogger.Printf("tid=[%s]. Attempt [%d] of [%d]: %v. Retrying in [%v]", tid, attempt, mm.config.maxRetries+1, err, delay)
+		time.Sleep(delay)
+	}
+}
+
+func (mm *metadataMapper) recordOutcome(err *deliveryError) {
+	if mm.breaker == nil {
+		return
+	}
+	switch {
+	case err == nil:
+		mm.breaker.success()
+	case err.retryable:
+		mm.breaker.failure()
+	case err.statusCode != 0:
+		//a client error response still means cms-metadata-notifier is up
+		mm.breaker.success()
+	default:
+		//every outcome must settle the probe of a half-open breaker
+		mm.breaker.failure()
+	}
+}
+
+func (mm *metadataMapper) sendMetadataAttempt(metadata []byte, tid string) *deliveryError {
 	req, err := http.NewRequest("POST", mm.config.cmsMetadataNotifierAddr+"/notify", bytes.NewReader(metadata))
 	if err != nil {
-		return fmt.Errorf("Creating request: [%v]", err)
+		return &deliveryError{msg: fmt.Sprintf("Creating request: [%v]", err)}
 	}
 	req.Header.Add("X-Origin-System-Id", "brightcove")
 	req.Header.Add("X-Request-Id", tid)
@@ -119,23 +413,42 @@ func (mm *metadataMapper) sendMetadata(metadata []byte, tid string) error {
 	}
 	resp, err := mm.client.Do(req)
 	if err != nil {
-		return fmt.Errorf("Sending metadata to notifier: [%v]", err)
+		ne, ok := err.(net.Error)
+		return &deliveryError{msg: fmt.Sprintf("Sending metadata to notifier: [%v]", err), retryable: true, timeout: ok && ne.Timeout()}
 	}
 	defer cleanupResp(resp)
 	if resp.StatusCode != 200 {
-		return fmt.Errorf("Sending metadata to notifier: unexpected status code: [%d]", resp.StatusCode)
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, maxResponseBodyKept))
+		return &deliveryError{
+			msg:        fmt.Sprintf("Sending metadata to notifier: unexpected status code: [%d]", resp.StatusCode),
+			statusCode: resp.StatusCode,
+			body:       string(body),
+			retryable:  resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests,
+			retryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+		}
 	}
 	return nil
 }
 
 func handleServerErr(w http.ResponseWriter, errMsg string) {
-	warnLogger.Printf(errMsg)
-	w.WriteHeader(http.StatusInternalServerError)
+	handleErr(w, http.StatusInternalServerError, errMsg)
 }
 
 func handleClientErr(w http.ResponseWriter, errMsg string) {
+	handleErr(w, http.StatusBadRequest, errMsg)
+}
+
+func handleErr(w http.ResponseWriter, status int, errMsg string) {
 	warnLogger.Printf(errMsg)
-	w.WriteHeader(http.StatusBadRequest)
+	w.WriteHeader(status)
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		warnLogger.Printf("Writing JSON response: [%v]", err)
+	}
 }
 
 func cleanupResp(resp *http.Response) {
@@ -148,3 +461,13 @@ func cleanupResp(resp *http.Response) {
 		warnLogger.Printf("[%v]", err)
 	}
 }
+
+func trimAll(values []string) []string {
+	var trimmed []string
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v != "" {
+			trimmed = append(trimmed, v)
+		}
+	}
+	return trimmed
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
 	"io/ioutil"
 	"net/http"
@@ -24,7 +25,7 @@ func TestHandleNotification_RequestBodyValidation_CorrectStatusCodeReturned(t *t
 	}{
 		{
 			`{"scenario" : invalidJson"}`,
-			500,
+			400,
 		},
 		{
 			`{"scenario" : "no uuid"}`,
@@ -291,3 +292,113 @@ func TestHandleReload_ErrorOnMappingServerRequest(t *testing.T) {
 		t.Errorf("Expected status code: [%d]. Actual: [%d]", 500, w.Code)
 	}
 }
+
+func TestHandleNotification_SuccessfulSend_StructuredResponseReturned(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	mm := metadataMapper{
+		config: &notifierConfig{cmsMetadataNotifierAddr: ts.URL},
+		client: &http.Client{},
+		mappings: map[string]term{
+			"commodities": term{CanonicalName: "Commodities", ID: "MTA1-U2VjdGlvbnM=", Taxonomy: "Sections"},
+		},
+	}
+	req, err := http.NewRequest("POST", "test-url", bytes.NewReader([]byte(`{"uuid" : "1234", "tags" : ["commodities", "unknown"]}`)))
+	if err != nil {
+		t.Fatalf("[%v]", err)
+	}
+	req.Header.Set("X-Request-Id", "test_tid")
+	w := httptest.NewRecorder()
+
+	mm.handleNotification(w, req)
+
+	var resp notifyResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("[%v]", err)
+	}
+	if resp.UUID != "1234" || resp.TID != "test_tid" || resp.Result != resultSent {
+		t.Errorf("Unexpected response: [%+v]", resp)
+	}
+	if len(resp.Terms) != 1 || resp.Terms[0].ID != "MTA1-U2VjdGlvbnM=" {
+		t.Errorf("Unexpected terms: [%+v]", resp.Terms)
+	}
+	if len(resp.UnmappedTags) != 1 || resp.UnmappedTags[0] != "unknown" {
+		t.Errorf("Unexpected unmapped tags: [%+v]", resp.UnmappedTags)
+	}
+}
+
+func TestHandleNotification_DownstreamFailures_StatusCodeAndErrorCode(t *testing.T) {
+	var testCases = []struct {
+		notifierStatus int
+		respStatus     int
+		code           string
+		retryable      bool
+	}{
+		{http.StatusServiceUnavailable, http.StatusBadGateway, errCodeDownstreamError, true},
+		{http.StatusBadRequest, http.StatusBadGateway, errCodeDownstreamError, false},
+	}
+
+	for _, tc := range testCases {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(tc.notifierStatus)
+		}))
+		mm := metadataMapper{
+			config: &notifierConfig{cmsMetadataNotifierAddr: ts.URL},
+			client: &http.Client{},
+		}
+		req, err := http.NewRequest("POST", "test-url", bytes.NewReader([]byte(`{"uuid" : "1234", "tags" : []}`)))
+		if err != nil {
+			t.Fatalf("[%v]", err)
+		}
+		w := httptest.NewRecorder()
+
+		mm.handleNotification(w, req)
+		ts.Close()
+
+		if w.Code != tc.respStatus {
+			t.Errorf("Expected status code: [%d]. Actual: [%d]. Testcase: [%+v]", tc.respStatus, w.Code, tc)
+		}
+		var resp errorResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatalf("[%v]", err)
+		}
+		if resp.Code != tc.code || resp.Retryable != tc.retryable || resp.Message == "" {
+			t.Errorf("Unexpected error response: [%+v]. Testcase: [%+v]", resp, tc)
+		}
+	}
+}
+
+func TestBuildContentRef_Default_LegacyXMLUnchanged(t *testing.T) {
+	terms := []term{
+		{CanonicalName: "World", ID: "MQ==-U2VjdGlvbnM=", Taxonomy: "Sections", Predicate: predicateIsClassifiedBy},
+		{CanonicalName: "John Authers", ID: "Q0ItMDAwMDkyMw==-QXV0aG9ycw==", Taxonomy: "Authors", Predicate: predicateMentions},
+	}
+
+	marshalled, err := contentRefFormatter{}.format("1234", terms)
+	if err != nil {
+		t.Fatalf("Expected no error. Found: [%v]", err)
+	}
+
+	expected := `<contentRef><tags>` +
+		`<tag><term taxonomy="Sections" id="MQ==-U2VjdGlvbnM="><canonicalName>World</canonicalName></term><score confidence="90" relevance="90"></score></tag>` +
+		`<tag><term taxonomy="Authors" id="Q0ItMDAwMDkyMw==-QXV0aG9ycw=="><canonicalName>John Authers</canonicalName></term><score confidence="90" relevance="90"></score></tag>` +
+		`</tags><primarySection taxonomy="" id=""></primarySection></contentRef>`
+	if string(marshalled) != expected {
+		t.Errorf("Expected: [%s]. Actual: [%s]", expected, marshalled)
+	}
+}
+
+func TestBuildContentRef_PredicatesCarriedAndPrimarySectionSet(t *testing.T) {
+	terms := []term{
+		{CanonicalName: "Commodities", ID: "MTA1-U2VjdGlvbnM=", Taxonomy: "Sections", Predicate: predicateIsClassifiedBy},
+		{CanonicalName: "World", ID: "MQ==-U2VjdGlvbnM=", Taxonomy: "Sections", Predicate: predicateIsPrimarilyClassifiedBy},
+	}
+
+	cr := buildContentRef(terms, true)
+
+	if cr.TagHolder.Tags[0].Predicate != predicateIsClassifiedBy || cr.TagHolder.Tags[1].Predicate != predicateIsPrimarilyClassifiedBy {
+		t.Errorf("Unexpected tags: [%+v]", cr.TagHolder.Tags)
+	}
+	if cr.PrimarySection.ID != "MQ==-U2VjdGlvbnM=" {
+		t.Errorf("Expected primary section: [MQ==-U2VjdGlvbnM=]. Actual: [%+v]", cr.PrimarySection)
+	}
+}
@@ -8,7 +8,11 @@ import (
 )
 
 func (hc healthcheck) health() func(w http.ResponseWriter, r *http.Request) {
-	return fthealth.HandlerParallel("Dependent services healthcheck", "Checks if all the dependent services are reachable and healthy.", hc.cmsMetadataNotifierReachable(), hc.mappingSpreadsheetAvailable())
+	checks := []fthealth.Check{hc.cmsMetadataNotifierReachable(), hc.mappingSpreadsheetAvailable()}
+	if hc.breaker != nil {
+		checks = append(checks, hc.circuitBreakerClosed())
+	}
+	return fthealth.HandlerParallel("Dependent services healthcheck", "Checks if all the dependent services are reachable and healthy.", checks...)
 }
 
 func (hc healthcheck) gtg(w http.ResponseWriter, r *http.Request) {
@@ -79,3 +83,21 @@ func (hc healthcheck) checkBerthaSpreadsheetHealth() error {
 	}
 	return nil
 }
+
+func (hc healthcheck) circuitBreakerClosed() fthealth.Check {
+	return fthealth.Check{
+		BusinessImpact:   "Video metadata is rejected without being sent to UPP stack until cms-metadata-notifier recovers.",
+		Name:             "CMS Metadata Notifier Circuit Breaker Closed",
+		PanicGuide:       "<coco runbook>",
+		Severity:         2,
+		TechnicalSummary: "Recent sends to CMS Metadata Notifier kept failing and the circuit breaker stopped calling it.",
+		Checker:          hc.checkCircuitBreakerState,
+	}
+}
+
+func (hc healthcheck) checkCircuitBreakerState() error {
+	if state := hc.breaker.currentState(); state != breakerClosed {
+		return fmt.Errorf("Circuit breaker is [%s]", state)
+	}
+	return nil
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+const ruleExpansion = "expansion"
+
+// broaderConcept is a parent of a concept in the hierarchy
+type broaderConcept struct {
+	ID   string
+	Name string
+}
+
+// hierarchy lists the broader concepts of each TME ID
+type hierarchy map[string][]broaderConcept
+
+// loadHierarchy reads the hierarchy sheet from a URL or a local file, a JSON array of rows with the id, broaderid and
+// broadername columns
+func loadHierarchy(source string) (hierarchy, error) {
+	var body []byte
+	var err error
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		body, err = fetchHierarchy(source)
+	} else {
+		body, err = ioutil.ReadFile(source)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Couldn't read hierarchy: [%v]", err)
+	}
+	var entries []map[string]string
+	if err = json.Unmarshal(body, &entries); err != nil {
+		return nil, fmt.Errorf("Couldn't decode hierarchy: [%v]", err)
+	}
+	h := make(hierarchy)
+	for _, entry := range entries {
+		id, broaderID := strings.TrimSpace(entry["id"]), strings.TrimSpace(entry["broaderid"])
+		if id == "" || broaderID == "" {
+			errorLogger.Printf("Missing id or broaderid in hierarchy row: [%+v]", entry)
+			continue
+		}
+		if _, err = decodeTaxonomy(broaderID); err != nil {
+			errorLogger.Println(err)
+			continue
+		}
+		h.add(id, broaderConcept{ID: broaderID, Name: strings.TrimSpace(entry["broadername"])})
+	}
+	return h, nil
+}
+
+func fetchHierarchy(hierarchyURL string) ([]byte, error) {
+	resp, err := http.Get(hierarchyURL)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanupResp(resp)
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("unexpected status code: [%d]", resp.StatusCode)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+func (h hierarchy) add(id string, b broaderConcept) {
+	for _, existing := range h[id] {
+		if existing.ID == b.ID {
+			return
+		}
+	}
+	h[id] = append(h[id], b)
+}
+
+// hierarchyFromConcepts walks up the broader concepts of the mapped concepts, as given by the concept lookup service
+func hierarchyFromConcepts(mappings map[string]term, cc *conceptClient, maxDepth int, h hierarchy) {
+	level := make(map[string]bool)
+	for _, t := range mappings {
+		level[t.ID] = true
+	}
+	walked := make(map[string]bool)
+	for depth := 0; depth < maxDepth && len(level) > 0; depth++ {
+		next := make(map[string]bool)
+		for id := range level {
+			walked[id] = true
+			info, err := cc.lookup(id)
+			if err != nil {
+				warnLogger.Printf("Couldn't get the broader concepts of [%s]: %v", id, err)
+				continue
+			}
+			if info == nil {
+				continue
+			}
+			for _, broaderID := range info.Broader {
+				name := broaderID
+				if broader, err := cc.lookup(broaderID); err == nil && broader != nil && broader.PrefLabel != "" {
+					name = broader.PrefLabel
+				}
+				h.add(id, broaderConcept{ID: broaderID, Name: name})
+				if !walked[broaderID] {
+					next[broaderID] = true
+				}
+			}
+		}
+		level = next
+	}
+}
+
+// cycles returns the concepts which are, through their broader concepts, broader than themselves
+func (h hierarchy) cycles() []string {
+	var cyclic []string
+	for id := range h {
+		if h.reaches(id, id) {
+			cyclic = append(cyclic, id)
+		}
+	}
+	sort.Strings(cyclic)
+	return cyclic
+}
+
+func (h hierarchy) reaches(from string, to string) bool {
+	visited := make(map[string]bool)
+	stack := []string{from}
+	for len(stack) > 0 {
+		id := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		for _, b := range h[id] {
+			if b.ID == to {
+				return true
+			}
+			if !visited[b.ID] {
+				visited[b.ID] = true
+				stack = append(stack, b.ID)
+			}
+		}
+	}
+	return false
+}
+
+// expand adds the broader concepts of the terms, up to the configured depth and with the expansion score.
+// A concept is added once, and never when it's already mapped directly, which also stops the walk on cycles.
+// Must be called with the read lock held.
+func (mm *metadataMapper) expand(terms []term) []term {
+	if len(mm.hierarchy) == 0 || mm.config.hierarchyMaxDepth <= 0 {
+		return terms
+	}
+	seen := make(map[string]bool)
+	for _, t := range terms {
+		seen[t.ID] = true
+	}
+	score := tagScore{Confidence: mm.config.expansionScore, Relevance: mm.config.expansionScore}
+	expanded := terms
+	for _, t := range terms {
+		level := []term{t}
+		for depth := 1; depth <= mm.config.hierarchyMaxDepth && len(level) > 0; depth++ {
+			var next []term
+			for _, child := range level {
+				for _, b := range mm.hierarchy[child.ID] {
+					if seen[b.ID] {
+						continue
+					}
+					seen[b.ID] = true
+					parent := mm.broaderTerm(b, child, depth, score)
+					expanded = append(expanded, parent)
+					next = append(next, parent)
+				}
+			}
+			level = next
+		}
+	}
+	return expanded
+}
+
+func (mm *metadataMapper) broaderTerm(b broaderConcept, child term, depth int, score tagScore) term {
+	taxonomy, _ := decodeTaxonomy(b.ID)
+	name := b.Name
+	if name == "" {
+		name = b.ID
+	}
+	t := term{CanonicalName: name, ID: b.ID, Taxonomy: taxonomy, Score: &score}
+	applyDefaultPredicate(&t, mm.config.defaultPredicates)
+	p := provenance{ExpandedFrom: child.ID, Depth: depth, Rule: ruleExpansion, MappingVersion: mm.mappingVersion}
+	if child.Provenance != nil {
+		p.SourceTag, p.Key = child.Provenance.SourceTag, child.Provenance.Key
+	}
+	t.Provenance = &p
+	return t
+}
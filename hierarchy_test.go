@@ -0,0 +1,84 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadHierarchy_FromFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hierarchy")
+	if err != nil {
+		t.Fatalf("[%v]", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "hierarchy.json")
+	rows := `[{"id":"QnJhemls-UmVnaW9ucw==","broaderid":"TGF0QW0=-UmVnaW9ucw==","broadername":"Latin America"},{"id":"QnJhemls-UmVnaW9ucw==","broaderid":"no taxonomy"}]`
+	if err = ioutil.WriteFile(path, []byte(rows), 0644); err != nil {
+		t.Fatalf("[%v]", err)
+	}
+
+	h, err := loadHierarchy(path)
+	if err != nil {
+		t.Fatalf("Expected no error. Found: [%v]", err)
+	}
+	if broader := h["QnJhemls-UmVnaW9ucw=="]; len(broader) != 1 || broader[0].Name != "Latin America" {
+		t.Errorf("Unexpected broader concepts: [%+v]", broader)
+	}
+}
+
+func TestExpand_BroaderConceptsAddedUpToMaxDepth(t *testing.T) {
+	mm := metadataMapper{
+		config: &notifierConfig{hierarchyMaxDepth: 2, expansionScore: 50},
+		mappings: map[string]term{
+			"brazil": {CanonicalName: "Brazil", ID: "QnJhemls-UmVnaW9ucw==", Taxonomy: "Regions", Provenance: &provenance{Row: 3}},
+		},
+		hierarchy: hierarchy{
+			"QnJhemls-UmVnaW9ucw==":     {{ID: "TGF0QW0=-UmVnaW9ucw==", Name: "Latin America"}},
+			"TGF0QW0=-UmVnaW9ucw==":     {{ID: "QW1lcmljYXM=-UmVnaW9ucw==", Name: "Americas"}},
+			"QW1lcmljYXM=-UmVnaW9ucw==": {{ID: "V29ybGQ=-UmVnaW9ucw==", Name: "World"}},
+		},
+	}
+
+	a := mm.annotate(video{UUID: "1234", Tags: []string{"Brazil"}}, "tid_test")
+
+	if len(a.Terms) != 3 {
+		t.Fatalf("Expected Brazil and 2 levels of broader concepts. Found: [%+v]", a.Terms)
+	}
+	latAm := a.Terms[1]
+	if latAm.CanonicalName != "Latin America" || latAm.Taxonomy != "Regions" || latAm.Score == nil || latAm.Score.Relevance != 50 {
+		t.Errorf("Unexpected broader term: [%+v]", latAm)
+	}
+	p := latAm.Provenance
+	if p.Rule != ruleExpansion || p.ExpandedFrom != "QnJhemls-UmVnaW9ucw==" || p.Depth != 1 || p.SourceTag != "Brazil" {
+		t.Errorf("Unexpected provenance: [%+v]", p)
+	}
+	if a.Terms[2].CanonicalName != "Americas" || a.Terms[2].Provenance.Depth != 2 {
+		t.Errorf("Unexpected broader term: [%+v]", a.Terms[2])
+	}
+	if a.Terms[0].Score != nil {
+		t.Error("Expected the mapped term to keep the default score.")
+	}
+}
+
+func TestExpand_Cycle_EachConceptAddedOnce(t *testing.T) {
+	h := hierarchy{
+		"QQ==-UmVnaW9ucw==": {{ID: "Qg==-UmVnaW9ucw==", Name: "B"}},
+		"Qg==-UmVnaW9ucw==": {{ID: "QQ==-UmVnaW9ucw==", Name: "A"}},
+	}
+	mm := metadataMapper{
+		config:    &notifierConfig{hierarchyMaxDepth: 10, expansionScore: 50},
+		mappings:  map[string]term{"a": {CanonicalName: "A", ID: "QQ==-UmVnaW9ucw==", Taxonomy: "Regions"}},
+		hierarchy: h,
+	}
+
+	a := mm.annotate(video{UUID: "1234", Tags: []string{"a"}}, "tid_test")
+
+	if len(a.Terms) != 2 {
+		t.Errorf("Expected A and B once. Found: [%+v]", a.Terms)
+	}
+	if cycles := h.cycles(); len(cycles) != 2 {
+		t.Errorf("Expected both concepts reported in a cycle. Found: [%v]", cycles)
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type mappingHit struct {
+	Count   int       `json:"count"`
+	LastHit time.Time `json:"lastHit"`
+}
+
+// mappingHits counts how often each mapping key matched a tag; it's saved to a file periodically when a path is configured
+type mappingHits struct {
+	sync.Mutex
+	path  string
+	hits  map[string]*mappingHit
+	dirty bool
+	now   func() time.Time
+}
+
+func newMappingHits(path string) (*mappingHits, error) {
+	h := &mappingHits{path: path, hits: make(map[string]*mappingHit), now: time.Now}
+	if path == "" {
+		return h, nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return h, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Reading mapping hits: [%v]", err)
+	}
+	if err = json.Unmarshal(data, &h.hits); err != nil {
+		return nil, fmt.Errorf("Decoding mapping hits: [%v]", err)
+	}
+	return h, nil
+}
+
+func (h *mappingHits) record(keys []string) {
+	h.Lock()
+	defer h.Unlock()
+	now := h.now().UTC()
+	for _, key := range keys {
+		hit, present := h.hits[key]
+		if !present {
+			hit = &mappingHit{}
+			h.hits[key] = hit
+		}
+		hit.Count++
+		hit.LastHit = now
+	}
+	h.dirty = len(keys) > 0 || h.dirty
+}
+
+func (h *mappingHits) get(key string) (mappingHit, bool) {
+	h.Lock()
+	defer h.Unlock()
+	hit, present := h.hits[key]
+	if !present {
+		return mappingHit{}, false
+	}
+	return *hit, true
+}
+
+func (h *mappingHits) save() error {
+	h.Lock()
+	if !h.dirty {
+		h.Unlock()
+		return nil
+	}
+	data, err := json.Marshal(h.hits)
+	h.dirty = false
+	h.Unlock()
+	if err != nil {
+		return fmt.Errorf("Encoding mapping hits: [%v]", err)
+	}
+	tmp := h.path + ".tmp"
+	if err = ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("Writing mapping hits: [%v]", err)
+	}
+	if err = os.Rename(tmp, h.path); err != nil {
+		return fmt.Errorf("Writing mapping hits: [%v]", err)
+	}
+	return nil
+}
+
+func (h *mappingHits) saveEvery(interval time.Duration) {
+	for range time.Tick(interval) {
+		if err := h.save(); err != nil {
+			errorLogger.Println(err)
+		}
+	}
+}
+
+func (mm *metadataMapper) recordHits(terms []term) {
+	if mm.hits == nil {
+		return
+	}
+	var keys []string
+	for _, t := range terms {
+		if t.Provenance != nil && (t.Provenance.Rule == ruleExact || t.Provenance.Rule == ruleSuggestion) {
+			keys = append(keys, t.Provenance.Key)
+		}
+	}
+	mm.hits.record(keys)
+}
+
+type unusedMapping struct {
+	Key           string     `json:"key"`
+	CanonicalName string     `json:"canonicalName"`
+	ID            string     `json:"id"`
+	Row           int        `json:"row"`
+	Count         int        `json:"count"`
+	LastHit       *time.Time `json:"lastHit"`
+}
+
+// unusedMappings returns the loaded mappings which didn't match any tag within the window, never matched ones first
+func (mm *metadataMapper) unusedMappings(window time.Duration) []unusedMapping {
+	since := mm.hits.now().Add(-window)
+	unused := []unusedMapping{}
+
+	mm.RLock()
+	defer mm.RUnlock()
+	for key, t := range mm.mappings {
+		hit, present := mm.hits.get(key)
+		if present && hit.LastHit.After(since) {
+			continue
+		}
+		um := unusedMapping{Key: key, CanonicalName: t.CanonicalName, ID: t.ID}
+		if t.Provenance != nil {
+			um.Row = t.Provenance.Row
+		}
+		if present {
+			lastHit := hit.LastHit
+			um.Count = hit.Count
+			um.LastHit = &lastHit
+		}
+		unused = append(unused, um)
+	}
+	sort.Sort(byLastHit(unused))
+	return unused
+}
+
+type byLastHit []unusedMapping
+
+func (u byLastHit) Len() int      { return len(u) }
+func (u byLastHit) Swap(i, j int) { u[i], u[j] = u[j], u[i] }
+func (u byLastHit) Less(i, j int) bool {
+	switch {
+	case u[i].LastHit == nil && u[j].LastHit == nil:
+		return u[i].Row < u[j].Row
+	case u[i].LastHit == nil:
+		return true
+	case u[j].LastHit == nil:
+		return false
+	}
+	return u[i].LastHit.Before(*u[j].LastHit)
+}
+
+func (mm *metadataMapper) handleUnusedMappings(w http.ResponseWriter, r *http.Request) {
+	window := mm.config.unusedMappingWindow
+	if days := r.URL.Query().Get("days"); days != "" {
+		d, err := strconv.Atoi(days)
+		if err != nil || d < 0 {
+			handleClientErr(w, fmt.Sprintf("Invalid days: [%s]", days))
+			return
+		}
+		window = time.Duration(d) * 24 * time.Hour
+	}
+	writeJSON(w, http.StatusOK, mm.unusedMappings(window))
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestUnusedMappings_OnlyMappingsWithoutRecentHitsReported(t *testing.T) {
+	now := time.Now()
+	hits, _ := newMappingHits("")
+	hits.now = func() time.Time { return now }
+	mm := metadataMapper{
+		hits: hits,
+		mappings: map[string]term{
+			"recent": term{ID: "1", Provenance: &provenance{Row: 1}},
+			"stale":  term{ID: "2", Provenance: &provenance{Row: 2}},
+			"never":  term{ID: "3", Provenance: &provenance{Row: 3}},
+		},
+	}
+	hits.record([]string{"stale"})
+	now = now.Add(48 * time.Hour)
+	hits.record([]string{"recent"})
+
+	unused := mm.unusedMappings(24 * time.Hour)
+
+	if len(unused) != 2 {
+		t.Fatalf("Expected unused mappings: [2]. Actual: [%+v]", unused)
+	}
+	if unused[0].Key != "never" || unused[0].LastHit != nil {
+		t.Errorf("Expected never matched mapping first. Actual: [%+v]", unused[0])
+	}
+	if unused[1].Key != "stale" || unused[1].Count != 1 || unused[1].Row != 2 {
+		t.Errorf("Unexpected stale mapping: [%+v]", unused[1])
+	}
+}
+
+func TestMappingHits_SavedAndReloaded(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hits")
+	if err != nil {
+		t.Fatalf("[%v]", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "hits.json")
+
+	hits, err := newMappingHits(path)
+	if err != nil {
+		t.Fatalf("Expected no error. Found: [%v]", err)
+	}
+	hits.record([]string{"brazil", "brazil"})
+	if err = hits.save(); err != nil {
+		t.Fatalf("Expected no error. Found: [%v]", err)
+	}
+
+	reloaded, err := newMappingHits(path)
+	if err != nil {
+		t.Fatalf("Expected no error. Found: [%v]", err)
+	}
+	if hit, present := reloaded.get("brazil"); !present || hit.Count != 2 {
+		t.Errorf("Expected [brazil] with 2 hits. Actual: [%+v]", hit)
+	}
+}
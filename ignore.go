@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// tagFilter tells the Brightcove tags which are housekeeping values rather than metadata.
+// Its rules are exact values, prefixes ending with * and regular expressions between slashes, all case insensitive.
+type tagFilter struct {
+	exact    map[string]bool
+	prefixes []string
+	patterns []*regexp.Regexp
+}
+
+func newTagFilter(rules []string) (*tagFilter, error) {
+	f := &tagFilter{exact: make(map[string]bool)}
+	for _, rule := range rules {
+		rule = strings.TrimSpace(rule)
+		switch {
+		case rule == "" || strings.HasPrefix(rule, "#"):
+		case len(rule) > 1 && strings.HasPrefix(rule, "/") && strings.HasSuffix(rule, "/"):
+			pattern, err := regexp.Compile("(?i)" + rule[1:len(rule)-1])
+			if err != nil {
+				return nil, fmt.Errorf("Invalid ignored tags pattern [%s]: [%v]", rule, err)
+			}
+			f.patterns = append(f.patterns, pattern)
+		case strings.HasSuffix(rule, "*"):
+			f.prefixes = append(f.prefixes, strings.ToLower(strings.TrimSuffix(rule, "*")))
+		default:
+			f.exact[strings.ToLower(rule)] = true
+		}
+	}
+	return f, nil
+}
+
+// readIgnoreRules gathers the rules of a JSON list, commas being valid in the patterns, and the ones of the file, one per line
+func readIgnoreRules(list string, path string) ([]string, error) {
+	var rules []string
+	if strings.TrimSpace(list) != "" {
+		if err := json.Unmarshal([]byte(list), &rules); err != nil {
+			return nil, fmt.Errorf("Decoding ignored tags, expected a JSON list of rules: [%v]", err)
+		}
+	}
+	if path == "" {
+		return rules, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("Opening ignored tags: [%v]", err)
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		rules = append(rules, scanner.Text())
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, fmt.Errorf("Reading ignored tags: [%v]", err)
+	}
+	return rules, nil
+}
+
+func (f *tagFilter) ignores(tag string) bool {
+	key := strings.ToLower(strings.TrimSpace(tag))
+	if f.exact[key] {
+		return true
+	}
+	for _, prefix := range f.prefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	for _, pattern := range f.patterns {
+		if pattern.MatchString(key) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *tagFilter) empty() bool {
+	return len(f.exact) == 0 && len(f.prefixes) == 0 && len(f.patterns) == 0
+}
+
+type ignoredTag struct {
+	Tag   string `json:"tag"`
+	Count int    `json:"count"`
+}
+
+type ignoredTags struct {
+	Total int          `json:"total"`
+	Tags  []ignoredTag `json:"tags"`
+}
+
+// ignoredTagCounter counts the ignored tags apart from the unmapped ones; past the limit of distinct tags, only the total grows
+type ignoredTagCounter struct {
+	sync.Mutex
+	limit  int
+	total  int
+	counts map[string]*ignoredTag
+}
+
+func newIgnoredTagCounter(limit int) *ignoredTagCounter {
+	return &ignoredTagCounter{limit: limit, counts: make(map[string]*ignoredTag)}
+}
+
+func (c *ignoredTagCounter) record(tags []string) {
+	c.Lock()
+	defer c.Unlock()
+	for _, tag := range tags {
+		c.total++
+		key := strings.ToLower(tag)
+		it, present := c.counts[key]
+		if !present {
+			if len(c.counts) >= c.limit {
+				continue
+			}
+			it = &ignoredTag{Tag: tag}
+			c.counts[key] = it
+		}
+		it.Count++
+	}
+}
+
+// list returns the ignored tags, most frequent first
+func (c *ignoredTagCounter) list() ignoredTags {
+	c.Lock()
+	defer c.Unlock()
+	its := ignoredTags{Total: c.total, Tags: make([]ignoredTag, 0, len(c.counts))}
+	for _, it := range c.counts {
+		its.Tags = append(its.Tags, *it)
+	}
+	sort.Sort(byIgnoredCount(its.Tags))
+	return its
+}
+
+type byIgnoredCount []ignoredTag
+
+func (t byIgnoredCount) Len() int      { return len(t) }
+func (t byIgnoredCount) Swap(i, j int) { t[i], t[j] = t[j], t[i] }
+func (t byIgnoredCount) Less(i, j int) bool {
+	if t[i].Count != t[j].Count {
+		return t[i].Count > t[j].Count
+	}
+	return t[i].Tag < t[j].Tag
+}
+
+func (mm *metadataMapper) ignored(tag string) bool {
+	return mm.ignore != nil && mm.ignore.ignores(tag)
+}
+
+func (mm *metadataMapper) recordIgnored(tags []string) {
+	if mm.ignoredTags == nil || len(tags) == 0 {
+		return
+	}
+	mm.ignoredTags.record(tags)
+}
+
+func (mm *metadataMapper) handleIgnored(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, mm.ignoredTags.list())
+}
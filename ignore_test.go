@@ -0,0 +1,94 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTagFilter_ExactPrefixAndPattern(t *testing.T) {
+	f, err := newTagFilter([]string{"ft:noads", "player:*", "/^internal-[0-9]+$/", "# comment", ""})
+	if err != nil {
+		t.Fatalf("Expected no error. Found: [%v]", err)
+	}
+	for _, tag := range []string{"ft:noads", "FT:NoAds", "player:autoplay", "internal-42"} {
+		if !f.ignores(tag) {
+			t.Errorf("Expected [%s] ignored.", tag)
+		}
+	}
+	for _, tag := range []string{"ft:noads2", "section:world", "internal-x", "# comment"} {
+		if f.ignores(tag) {
+			t.Errorf("Expected [%s] not ignored.", tag)
+		}
+	}
+}
+
+func TestNewTagFilter_InvalidPattern_ErrorReturned(t *testing.T) {
+	if _, err := newTagFilter([]string{"/[/"}); err == nil {
+		t.Error("Expected error.")
+	}
+}
+
+func TestReadIgnoreRules_JSONListAndFile_PatternsWithCommasKept(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ignore")
+	if err != nil {
+		t.Fatalf("[%v]", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "ignored-tags.txt")
+	if err = ioutil.WriteFile(path, []byte("# housekeeping\n/^ad-[a-z]{2,4}$/\n"), 0644); err != nil {
+		t.Fatalf("[%v]", err)
+	}
+
+	rules, err := readIgnoreRules(`["ft:noads", "/^internal-[0-9]{1,3}$/"]`, path)
+	if err != nil {
+		t.Fatalf("Expected no error. Found: [%v]", err)
+	}
+	f, err := newTagFilter(rules)
+	if err != nil {
+		t.Fatalf("Expected no error. Found: [%v]", err)
+	}
+	for _, tag := range []string{"ft:noads", "internal-123", "ad-pre"} {
+		if !f.ignores(tag) {
+			t.Errorf("Expected [%s] ignored.", tag)
+		}
+	}
+	if f.ignores("internal-1234") {
+		t.Error("Expected [internal-1234] not ignored.")
+	}
+
+	if _, err = readIgnoreRules("ft:noads,player:*", ""); err == nil {
+		t.Error("Expected error for a list which isn't JSON.")
+	}
+}
+
+func TestHandleNotification_IgnoredTags_CountedApartFromUnmapped(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+	ignore, _ := newTagFilter([]string{"player:*"})
+	mm := metadataMapper{
+		config:      &notifierConfig{cmsMetadataNotifierAddr: ts.URL},
+		client:      &http.Client{},
+		mappings:    map[string]term{},
+		unmapped:    newUnmappedTagStore(10),
+		ignore:      ignore,
+		ignoredTags: newIgnoredTagCounter(10),
+	}
+
+	w := httptest.NewRecorder()
+	mm.handleNotification(w, httptest.NewRequest("POST", "/notify", strings.NewReader(`{"uuid":"1234","tags":["player:autoplay","unknown"]}`)))
+
+	if !strings.Contains(w.Body.String(), `"unmappedTags":["unknown"],"ignoredTags":["player:autoplay"]`) {
+		t.Errorf("Unexpected response: [%s]", w.Body.String())
+	}
+	if uts := mm.unmapped.list(); len(uts) != 1 || uts[0].Tag != "unknown" {
+		t.Errorf("Expected the ignored tag not counted as unmapped. Found: [%+v]", uts)
+	}
+	if its := mm.ignoredTags.list(); its.Total != 1 || len(its.Tags) != 1 || its.Tags[0].Tag != "player:autoplay" {
+		t.Errorf("Unexpected ignored tags: [%+v]", its)
+	}
+}
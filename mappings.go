@@ -1,9 +1,12 @@
 package main
 
 import (
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"strings"
 )
@@ -14,7 +17,8 @@ type mapping struct {
 	value term
 }
 
-func fetchMappings(mappingURL string) map[string]term {
+// fetchMappings returns the mappings along with their version, derived from the content of the sheet
+func fetchMappings(mappingURL string, defaultPredicates map[string]string) (map[string]term, string) {
 	resp, err := http.Get(mappingURL)
 	if err != nil {
 		errorLogger.Panicf("Couldn't fetch mappings: [%#v]", err)
@@ -24,23 +28,32 @@ func fetchMappings(mappingURL string) map[string]term {
 		errorLogger.Panicf("Unhealthy status code received: [%v]", resp.StatusCode)
 	}
 
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		errorLogger.Panicf("Couldn't read mappings: [%#v]", err)
+	}
 	var entries []map[string]string
-	err = json.NewDecoder(resp.Body).Decode(&entries)
+	err = json.Unmarshal(body, &entries)
 	if err != nil {
 		errorLogger.Panicf("Couldn't decode mappings: [%#v]", err)
 	}
+	sum := sha256.Sum256(body)
+	version := hex.EncodeToString(sum[:6])
 
-	infoLogger.Println("Processing mappings...")
+	infoLogger.Printf("Processing mappings version [%s]...", version)
 	mappings := make(map[string]term, 0)
-	for _, entry := range entries {
+	for i, entry := range entries {
 		mapping, err := processMapping(entry)
 		if err != nil {
 			errorLogger.Println(err)
 			continue
 		}
+		applyDefaultPredicate(&mapping.value, defaultPredicates)
+		//sheet rows are counted from 1 and the first one holds the headers
+		mapping.value.Provenance = &provenance{Row: i + 2, MappingVersion: version}
 		mappings[mapping.key] = mapping.value
 	}
-	return mappings
+	return mappings, version
 }
 
 func processMapping(entry map[string]string) (*mapping, error) {
@@ -65,12 +78,20 @@ func processMapping(entry map[string]string) (*mapping, error) {
 	if err != nil {
 		return nil, err
 	}
+
+	predicate := strings.TrimSpace(entry["predicate"])
+	if predicate != "" {
+		if err = validatePredicate(predicate); err != nil {
+			return nil, fmt.Errorf("%v in mapping: [%+v]", err, entry)
+		}
+	}
 	return &mapping{
-		key: strings.ToLower(bcTag),
+		key: tagKey(bcTag),
 		value: term{
 			CanonicalName: bcTag,
 			ID:            termID,
 			Taxonomy:      taxonomy,
+			Predicate:     predicate,
 		},
 	}, nil
 }
@@ -90,7 +111,7 @@ func decodeTaxonomy(termID string) (string, error) {
 func (mm *metadataMapper) prettyPrintMappings() string {
 	s := fmt.Sprint("metadataMapper.mappings: [\n")
 	for _, entry := range mm.mappings {
-		s += fmt.Sprintf("\tCanonicalName: [%s], ID: [%s], Taxonomy: [%s]\n", entry.CanonicalName, entry.ID, entry.Taxonomy)
+		s += fmt.Sprintf("\tCanonicalName: [%s], ID: [%s], Taxonomy: [%s], Predicate: [%s]\n", entry.CanonicalName, entry.ID, entry.Taxonomy, entry.Predicate)
 	}
 	s += fmt.Sprint("]\n")
 	return s
@@ -106,3 +106,55 @@ func TestDecodeTaconomy_HappyScenario_DecodedTaxonomyIsCorrect(t *testing.T) {
 		t.Errorf("Expected: [%s]. Actual: [%s]", expected, actual)
 	}
 }
+
+func TestProcessMapping_PredicateColumn_ValidatedAndCarried(t *testing.T) {
+	m, err := processMapping(map[string]string{
+		"streamurl":            "/stream/sectionsId/MQ==-U2VjdGlvbnM=",
+		"brightcovesearchterm": "tag:section:world",
+		"predicate":            "isPrimarilyClassifiedBy",
+	})
+	if err != nil {
+		t.Fatalf("Expected success. Found: [%v]", err)
+	}
+	if m.value.Predicate != predicateIsPrimarilyClassifiedBy {
+		t.Errorf("Expected: [%s]. Actual: [%s]", predicateIsPrimarilyClassifiedBy, m.value.Predicate)
+	}
+
+	if _, err = processMapping(map[string]string{
+		"streamurl":            "/stream/sectionsId/MQ==-U2VjdGlvbnM=",
+		"brightcovesearchterm": "tag:section:world",
+		"predicate":            "isLovedBy",
+	}); err == nil {
+		t.Error("Expected failure for unknown predicate.")
+	}
+}
+
+func TestApplyDefaultPredicate_ConfiguredPerTaxonomyOrBuiltIn(t *testing.T) {
+	defaults, err := parseDefaultPredicates("Authors=hasAuthor, Sections=about")
+	if err != nil {
+		t.Fatalf("Expected success. Found: [%v]", err)
+	}
+	var testCases = []struct {
+		t        term
+		expected string
+	}{
+		{term{Taxonomy: "Authors"}, predicateHasAuthor},
+		{term{Taxonomy: "Sections"}, predicateAbout},
+		{term{Taxonomy: "Sections", Predicate: predicateMentions}, predicateMentions},
+		{term{Taxonomy: "Genres"}, predicateIsClassifiedBy},
+		{term{Taxonomy: "GL"}, predicateMentions},
+	}
+
+	for _, tc := range testCases {
+		applyDefaultPredicate(&tc.t, defaults)
+		if tc.t.Predicate != tc.expected {
+			t.Errorf("Expected: [%s]. Actual: [%s]. Testcase: [%+v]", tc.expected, tc.t.Predicate, tc)
+		}
+	}
+
+	for _, invalid := range []string{"Authors", "Authors=isLovedBy", "=about"} {
+		if _, err := parseDefaultPredicates(invalid); err == nil {
+			t.Errorf("Expected failure. Testcase: [%s]", invalid)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+)
+
+// titles dropped from the front of person names
+var honorifics = map[string]bool{
+	"mr": true, "mrs": true, "ms": true, "miss": true, "mx": true, "dr": true, "prof": true, "professor": true,
+	"sir": true, "dame": true, "lord": true, "lady": true, "rev": true, "revd": true,
+}
+
+// nameNormaliser matches person names whatever their form: "Authers, John", "john authers" and "John  Authers" are the
+// same. It applies to the tags of person namespaces and to the mappings of person taxonomies.
+type nameNormaliser struct {
+	namespaces map[string]bool
+	taxonomies map[string]bool
+}
+
+func newNameNormaliser(namespaces []string, taxonomies []string) *nameNormaliser {
+	n := &nameNormaliser{namespaces: make(map[string]bool), taxonomies: make(map[string]bool)}
+	for _, namespace := range namespaces {
+		n.namespaces[strings.ToLower(namespace)] = true
+	}
+	for _, taxonomy := range taxonomies {
+		n.taxonomies[taxonomy] = true
+	}
+	return n
+}
+
+func (n *nameNormaliser) appliesTo(tag brightcoveTag, taxonomy string) bool {
+	return n.namespaces[tag.Namespace] || n.taxonomies[taxonomy]
+}
+
+// key is the lookup key of a tag naming a person
+func (n *nameNormaliser) key(tag string) string {
+	parsed := parseTag(tag)
+	parsed.Value = normaliseName(parsed.Value)
+	return strings.ToLower(parsed.String())
+}
+
+// normaliseKeys returns the mappings with the persons keyed by their normalised name, and how many were rekeyed.
+// When two rows name the same person, the first row of the sheet wins.
+func (n *nameNormaliser) normaliseKeys(mappings map[string]term) (map[string]term, int) {
+	normalised := make(map[string]term, len(mappings))
+	rekeyed := 0
+	for key, t := range mappings {
+		if n.appliesTo(parseTag(key), t.Taxonomy) {
+			if k := n.key(key); k != key {
+				key = k
+				rekeyed++
+			}
+		}
+		existing, present := normalised[key]
+		if !present {
+			normalised[key] = t
+			continue
+		}
+		if existing.ID != t.ID {
+			warnLogger.Printf("Rows [%d] and [%d] name the same person [%s] with different concepts, keeping the first row", row(existing), row(t), key)
+		}
+		if row(t) < row(existing) {
+			normalised[key] = t
+		}
+	}
+	return normalised, rekeyed
+}
+
+func row(t term) int {
+	if t.Provenance == nil {
+		return 0
+	}
+	return t.Provenance.Row
+}
+
+// normaliseName turns a person name into lower case "first last" words: "Last, First" is inverted, leading honorifics are
+// dropped and initials are spaced out, "Dr J.K. Rowling" being "j k rowling"
+func normaliseName(name string) string {
+	if parts := strings.Split(name, ","); len(parts) == 2 && strings.TrimSpace(parts[0]) != "" && strings.TrimSpace(parts[1]) != "" {
+		name = parts[1] + " " + parts[0]
+	}
+	upperCase := strings.ToUpper(name) == name
+	var words []string
+	for _, token := range strings.Fields(name) {
+		for _, part := range strings.Split(token, ".") {
+			if part == "" {
+				continue
+			}
+			lower := strings.ToLower(part)
+			if len(words) == 0 && honorifics[lower] {
+				continue
+			}
+			if !upperCase && initials(part) {
+				for _, r := range lower {
+					words = append(words, string(r))
+				}
+				continue
+			}
+			words = append(words, lower)
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+// initials tells run together initials like "JK"
+func initials(word string) bool {
+	if len(word) < 2 || len(word) > 3 {
+		return false
+	}
+	for _, r := range word {
+		if !unicode.IsUpper(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// personTerm looks the tag up as a person name; must be called with the read lock held
+func (mm *metadataMapper) personTerm(tag string) (term, string, bool) {
+	if mm.names == nil {
+		return term{}, "", false
+	}
+	key := mm.names.key(tag)
+	t, present := mm.mappings[key]
+	if !present || !mm.names.appliesTo(parseTag(tag), t.Taxonomy) {
+		return term{}, "", false
+	}
+	return t, key, true
+}
@@ -0,0 +1,75 @@
+package main
+
+import "testing"
+
+func TestNormaliseName(t *testing.T) {
+	var testCases = []struct {
+		name     string
+		expected string
+	}{
+		{"John Authers", "john authers"},
+		{"Authers, John", "john authers"},
+		{"john  authers", "john authers"},
+		{" John Authers ", "john authers"},
+		{"Dr John Authers", "john authers"},
+		{"Prof. Sir John Authers", "john authers"},
+		{"J.K. Rowling", "j k rowling"},
+		{"J. K. Rowling", "j k rowling"},
+		{"JK Rowling", "j k rowling"},
+		{"Rowling, J.K.", "j k rowling"},
+		{"MARTIN WOLF", "martin wolf"},
+		{"Lady Gaga", "gaga"},
+	}
+	for _, tc := range testCases {
+		if actual := normaliseName(tc.name); actual != tc.expected {
+			t.Errorf("Expected [%s] for [%s]. Actual: [%s]", tc.expected, tc.name, actual)
+		}
+	}
+}
+
+func TestPersonTerm_SheetKeysAndTagsNormalised(t *testing.T) {
+	names := newNameNormaliser([]string{"author"}, []string{"Authors", "People"})
+	mappings := map[string]term{
+		"author:authers, john": {CanonicalName: "John Authers", ID: "Q0ItMDAwMDkyMw==-QXV0aG9ycw==", Taxonomy: "Authors", Provenance: &provenance{Row: 1}},
+		"martin  wolf":         {CanonicalName: "Martin Wolf", ID: "TVc=-UGVvcGxl", Taxonomy: "People", Provenance: &provenance{Row: 2}},
+		"section:world":        {CanonicalName: "World", ID: "MQ==-U2VjdGlvbnM=", Taxonomy: "Sections", Provenance: &provenance{Row: 3}},
+	}
+	mappings, rekeyed := names.normaliseKeys(mappings)
+	if rekeyed != 2 {
+		t.Errorf("Expected 2 mappings rekeyed. Found: [%d]", rekeyed)
+	}
+	mm := metadataMapper{config: &notifierConfig{}, mappings: mappings, names: names}
+
+	a := mm.annotate(video{UUID: "1234", Tags: []string{"author:John  Authers", "Wolf, Martin", "Dr Martin Wolf", "World, Section"}}, "tid_test")
+
+	if len(a.Terms) != 3 {
+		t.Fatalf("Expected 3 person terms. Found: [%+v]", a.Terms)
+	}
+	if a.Terms[0].CanonicalName != "John Authers" || a.Terms[1].CanonicalName != "Martin Wolf" || a.Terms[2].CanonicalName != "Martin Wolf" {
+		t.Errorf("Unexpected terms: [%+v]", a.Terms)
+	}
+	if len(a.Unmapped) != 1 || a.Unmapped[0] != "World, Section" {
+		t.Errorf("Expected names only normalised for persons. Found: [%v]", a.Unmapped)
+	}
+}
+
+func TestNormaliseKeys_SamePersonOnTwoRows_FirstRowKept(t *testing.T) {
+	names := newNameNormaliser(nil, []string{"People"})
+	mappings := map[string]term{
+		"wolf, martin":   {ID: "MQ==-UGVvcGxl", Taxonomy: "People", Provenance: &provenance{Row: 3}},
+		"dr martin wolf": {ID: "Mg==-UGVvcGxl", Taxonomy: "People", Provenance: &provenance{Row: 2}},
+		"martin wolf":    {ID: "Mw==-UGVvcGxl", Taxonomy: "People", Provenance: &provenance{Row: 4}},
+	}
+
+	normalised, rekeyed := names.normaliseKeys(mappings)
+
+	if rekeyed != 2 || len(normalised) != 1 {
+		t.Fatalf("Expected 2 mappings rekeyed into 1. Found: [%d] [%+v]", rekeyed, normalised)
+	}
+	if normalised["martin wolf"].ID != "Mg==-UGVvcGxl" {
+		t.Errorf("Expected the first row kept. Found: [%+v]", normalised["martin wolf"])
+	}
+	if len(mappings) != 3 {
+		t.Errorf("Expected the mappings passed in left untouched. Found: [%+v]", mappings)
+	}
+}
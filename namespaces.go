@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// namespacePattern tells a namespace prefix like "section:" from a value merely holding a colon, like "ft: the week"
+var namespacePattern = regexp.MustCompile(`^[a-z0-9_-]+$`)
+
+// brightcoveTag is a tag split into its namespace prefix, if any, and its value
+type brightcoveTag struct {
+	Namespace string
+	Value     string
+}
+
+func parseTag(tag string) brightcoveTag {
+	i := strings.Index(tag, ":")
+	if i <= 0 {
+		return brightcoveTag{Value: strings.TrimSpace(tag)}
+	}
+	namespace := strings.ToLower(strings.TrimSpace(tag[:i]))
+	if !namespacePattern.MatchString(namespace) {
+		return brightcoveTag{Value: strings.TrimSpace(tag)}
+	}
+	return brightcoveTag{Namespace: namespace, Value: strings.TrimSpace(tag[i+1:])}
+}
+
+func (t brightcoveTag) String() string {
+	if t.Namespace == "" {
+		return t.Value
+	}
+	return t.Namespace + ":" + t.Value
+}
+
+// tagKey is the lookup key of a tag in the mappings, its namespace and value being trimmed
+func tagKey(tag string) string {
+	return strings.ToLower(parseTag(tag).String())
+}
+
+// parseNamespaceTaxonomies reads the taxonomy expected for each namespace from a list like "section=Sections,author=Authors"
+func parseNamespaceTaxonomies(value string) (map[string]string, error) {
+	expected := make(map[string]string)
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" || strings.TrimSpace(kv[1]) == "" {
+			return nil, fmt.Errorf("Invalid namespace taxonomy, expected namespace=taxonomy: [%s]", pair)
+		}
+		expected[strings.ToLower(strings.TrimSpace(kv[0]))] = strings.TrimSpace(kv[1])
+	}
+	return expected, nil
+}
+
+// namespaceConflict is a mapping whose taxonomy contradicts the namespace of its tag
+type namespaceConflict struct {
+	Key       string `json:"key"`
+	Row       int    `json:"row,omitempty"`
+	Namespace string `json:"namespace"`
+	Expected  string `json:"expectedTaxonomy"`
+	Taxonomy  string `json:"taxonomy"`
+}
+
+// checkNamespaces flags the mappings of namespaced tags mapped to a concept of another taxonomy than expected
+func checkNamespaces(mappings map[string]term, expected map[string]string) []namespaceConflict {
+	conflicts := []namespaceConflict{}
+	for key, t := range mappings {
+		tag := parseTag(key)
+		if consistent(tag, t, expected) {
+			continue
+		}
+		c := namespaceConflict{Key: key, Namespace: tag.Namespace, Expected: expected[tag.Namespace], Taxonomy: t.Taxonomy}
+		if t.Provenance != nil {
+			c.Row = t.Provenance.Row
+		}
+		conflicts = append(conflicts, c)
+	}
+	sort.Sort(byConflictRow(conflicts))
+	return conflicts
+}
+
+// consistent tells whether the term has the taxonomy expected for the namespace of the tag, if there's one
+func consistent(tag brightcoveTag, t term, expected map[string]string) bool {
+	taxonomy, present := expected[tag.Namespace]
+	return !present || tag.Namespace == "" || t.Taxonomy == taxonomy
+}
+
+type byConflictRow []namespaceConflict
+
+func (c byConflictRow) Len() int      { return len(c) }
+func (c byConflictRow) Swap(i, j int) { c[i], c[j] = c[j], c[i] }
+func (c byConflictRow) Less(i, j int) bool {
+	if c[i].Row != c[j].Row {
+		return c[i].Row < c[j].Row
+	}
+	return c[i].Key < c[j].Key
+}
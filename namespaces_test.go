@@ -0,0 +1,55 @@
+package main
+
+import "testing"
+
+func TestParseTag_NamespaceAndValue(t *testing.T) {
+	var testCases = []struct {
+		tag       string
+		namespace string
+		value     string
+	}{
+		{"section:world", "section", "world"},
+		{"Author: John Authers", "author", "John Authers"},
+		{"emerging markets", "", "emerging markets"},
+		{"ft weekend: the week", "", "ft weekend: the week"},
+		{":world", "", ":world"},
+	}
+	for _, tc := range testCases {
+		actual := parseTag(tc.tag)
+		if actual.Namespace != tc.namespace || actual.Value != tc.value {
+			t.Errorf("Unexpected parsing of [%s]: [%+v]", tc.tag, actual)
+		}
+	}
+	if tagKey("Section : World") != "section:world" {
+		t.Errorf("Unexpected key: [%s]", tagKey("Section : World"))
+	}
+}
+
+func TestCheckNamespaces_ContradictingTaxonomyFlagged(t *testing.T) {
+	expected, err := parseNamespaceTaxonomies("section=Sections, author=Authors")
+	if err != nil {
+		t.Fatalf("Expected no error. Found: [%v]", err)
+	}
+	mappings := map[string]term{
+		"section:world":        {ID: "MQ==-U2VjdGlvbnM=", Taxonomy: "Sections"},
+		"section:john authers": {ID: "Q0ItMDAwMDkyMw==-QXV0aG9ycw==", Taxonomy: "Authors", Provenance: &provenance{Row: 7}},
+		"brand:lex":            {ID: "Mg==-QnJhbmRz", Taxonomy: "Brands"},
+		"emerging markets":     {ID: "MTA2-U2VjdGlvbnM=", Taxonomy: "Sections"},
+	}
+
+	conflicts := checkNamespaces(mappings, expected)
+
+	if len(conflicts) != 1 {
+		t.Fatalf("Expected 1 conflict. Found: [%+v]", conflicts)
+	}
+	c := conflicts[0]
+	if c.Key != "section:john authers" || c.Row != 7 || c.Expected != "Sections" || c.Taxonomy != "Authors" {
+		t.Errorf("Unexpected conflict: [%+v]", c)
+	}
+}
+
+func TestParseNamespaceTaxonomies_Invalid_ErrorReturned(t *testing.T) {
+	if _, err := parseNamespaceTaxonomies("section"); err == nil {
+		t.Error("Expected error.")
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+const statusSuperseded = "superseded"
+
+// videoSequencer serialises the sends for each video and lets a notification know when a newer one for the same video was received
+type videoSequencer struct {
+	sync.Mutex
+	seq    uint64
+	videos map[string]*videoSlot
+}
+
+type videoSlot struct {
+	sync.Mutex
+	latest  uint64
+	pending int
+}
+
+func newVideoSequencer() *videoSequencer {
+	return &videoSequencer{videos: make(map[string]*videoSlot)}
+}
+
+// register hands out the sequence number of a newly received notification
+func (s *videoSequencer) register(uuid string) uint64 {
+	s.Lock()
+	defer s.Unlock()
+	s.seq++
+	slot, present := s.videos[uuid]
+	if !present {
+		slot = &videoSlot{}
+		s.videos[uuid] = slot
+	}
+	slot.latest = s.seq
+	slot.pending++
+	return s.seq
+}
+
+// registerIdle registers a notification only when none is pending for the video
+func (s *videoSequencer) registerIdle(uuid string) (uint64, bool) {
+	s.Lock()
+	defer s.Unlock()
+	if _, present := s.videos[uuid]; present {
+		return 0, false
+	}
+	s.seq++
+	s.videos[uuid] = &videoSlot{latest: s.seq, pending: 1}
+	return s.seq, true
+}
+
+// acquire waits for the sends in progress for the video, then reports whether a newer notification superseded this one.
+// Every acquire must be followed by a release.
+func (s *videoSequencer) acquire(uuid string, seq uint64) bool {
+	s.Lock()
+	slot := s.videos[uuid]
+	s.Unlock()
+
+	slot.Lock()
+	s.Lock()
+	defer s.Unlock()
+	return seq < slot.latest
+}
+
+func (s *videoSequencer) release(uuid string) {
+	s.Lock()
+	defer s.Unlock()
+	slot := s.videos[uuid]
+	slot.Unlock()
+	s.discardLocked(uuid, slot)
+}
+
+// discard drops a registered notification which won't be sent
+func (s *videoSequencer) discard(uuid string) {
+	s.Lock()
+	defer s.Unlock()
+	s.discardLocked(uuid, s.videos[uuid])
+}
+
+func (s *videoSequencer) discardLocked(uuid string, slot *videoSlot) {
+	slot.pending--
+	if slot.pending == 0 {
+		delete(s.videos, uuid)
+	}
+}
+
+// debouncer holds the notifications of a video for a window and passes on the latest one only
+type debouncer struct {
+	sync.Mutex
+	window  time.Duration
+	pending map[string]*notification
+	fire    func(n *notification)
+}
+
+func newDebouncer(window time.Duration, fire func(n *notification)) *debouncer {
+	return &debouncer{window: window, pending: make(map[string]*notification), fire: fire}
+}
+
+// submit returns the notification replaced by n, if any
+func (d *debouncer) submit(n *notification) *notification {
+	d.Lock()
+	defer d.Unlock()
+	replaced, present := d.pending[n.UUID]
+	d.pending[n.UUID] = n
+	if present {
+		return replaced
+	}
+	uuid := n.UUID
+	time.AfterFunc(d.window, func() { d.flush(uuid) })
+	return nil
+}
+
+func (d *debouncer) flush(uuid string) {
+	d.Lock()
+	n := d.pending[uuid]
+	delete(d.pending, uuid)
+	d.Unlock()
+	d.fire(n)
+}
+
+func (mm *metadataMapper) register(uuid string) uint64 {
+	if mm.sequencer == nil {
+		return 0
+	}
+	return mm.sequencer.register(uuid)
+}
+
+// sendInOrder delivers the event unless a newer notification for the same video was received meanwhile, or, when not
+// forced, unless it's the same as the last one sent. Both are checked once the previous sends of the video are over.
+func (mm *metadataMapper) sendInOrder(ev *nativeCmsMetadataPublicationEvent, tid string, seq uint64, force bool) (string, error) {
+	if mm.sequencer != nil {
+		superseded := mm.sequencer.acquire(ev.UUID, seq)
+		defer mm.sequencer.release(ev.UUID)
+		if superseded {
+			return resultSuperseded, nil
+		}
+	}
+	if !force && mm.unchanged(ev) {
+		return resultNoChange, nil
+	}
+	if err := mm.deliver(ev, tid); err != nil {
+		return "", err
+	}
+	return resultSent, nil
+}
+
+// supersede settles a debounced notification replaced by a newer one for the same video
+func (mm *metadataMapper) supersede(n *notification) {
+	infoLogger.Printf("tid=[%s]. Notification=[%s] for video=[%s] superseded by a newer one", n.TID, n.ID, n.UUID)
+	if mm.sequencer != nil {
+		mm.sequencer.discard(n.UUID)
+	}
+	mm.queue.setStatus(n.ID, statusSuperseded, "")
+	mm.ackOutbox(n)
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestVideoSequencer_OlderNotificationSuperseded(t *testing.T) {
+	s := newVideoSequencer()
+	older := s.register("1234")
+	newer := s.register("1234")
+	other := s.register("5678")
+
+	if superseded := s.acquire("1234", older); !superseded {
+		t.Error("Expected older notification to be superseded.")
+	}
+	s.release("1234")
+	if superseded := s.acquire("1234", newer); superseded {
+		t.Error("Expected latest notification not to be superseded.")
+	}
+	s.release("1234")
+	if superseded := s.acquire("5678", other); superseded {
+		t.Error("Expected notification of another video not to be superseded.")
+	}
+	s.release("5678")
+
+	if len(s.videos) != 0 {
+		t.Errorf("Expected no videos tracked after release. Actual: [%d]", len(s.videos))
+	}
+}
+
+func TestDebouncer_BurstCollapsedIntoLatest(t *testing.T) {
+	fired := make(chan *notification, 10)
+	d := newDebouncer(20*time.Millisecond, func(n *notification) { fired <- n })
+	ev := &nativeCmsMetadataPublicationEvent{UUID: "1234"}
+
+	first := newNotification("id_1", "tid_1", ev)
+	second := newNotification("id_2", "tid_2", ev)
+	if replaced := d.submit(first); replaced != nil {
+		t.Errorf("Expected nothing replaced. Actual: [%s]", replaced.ID)
+	}
+	if replaced := d.submit(second); replaced != first {
+		t.Errorf("Expected [%s] to be replaced.", first.ID)
+	}
+
+	select {
+	case n := <-fired:
+		if n.ID != second.ID {
+			t.Errorf("Expected: [%s]. Actual: [%s]", second.ID, n.ID)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected the latest notification to be passed on.")
+	}
+	select {
+	case n := <-fired:
+		t.Errorf("Expected a single notification passed on. Found also: [%s]", n.ID)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestHandleNotification_PreviousTagsBackWhileNewerInFlight_SentLast(t *testing.T) {
+	var mu sync.Mutex
+	var sent []string
+	inFlight := make(chan struct{})
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var ev nativeCmsMetadataPublicationEvent
+		json.NewDecoder(r.Body).Decode(&ev)
+		value, _ := base64.StdEncoding.DecodeString(ev.Value)
+		if strings.Contains(string(value), "Brazil") {
+			close(inFlight)
+			<-release
+		}
+		mu.Lock()
+		sent = append(sent, string(value))
+		mu.Unlock()
+	}))
+	defer ts.Close()
+	store, _ := newSentStore(time.Hour, "")
+	mm := metadataMapper{
+		config: &notifierConfig{cmsMetadataNotifierAddr: ts.URL},
+		client: &http.Client{},
+		mappings: map[string]term{
+			"world":  {CanonicalName: "World", ID: "MQ==-U2VjdGlvbnM=", Taxonomy: "Sections"},
+			"brazil": {CanonicalName: "Brazil", ID: "QnJhemls-UmVnaW9ucw==", Taxonomy: "Regions"},
+		},
+		sent:      store,
+		sequencer: newVideoSequencer(),
+	}
+	notify := func(tags string) string {
+		w := httptest.NewRecorder()
+		mm.handleNotification(w, httptest.NewRequest("POST", "/notify", strings.NewReader(`{"uuid":"1234","tags":[`+tags+`]}`)))
+		var resp notifyResponse
+		json.NewDecoder(w.Body).Decode(&resp)
+		return resp.Result
+	}
+
+	if result := notify(`"world"`); result != resultSent {
+		t.Fatalf("Expected result: [%s]. Actual: [%s]", resultSent, result)
+	}
+	results := make(chan string, 2)
+	go func() { results <- notify(`"brazil"`) }()
+	<-inFlight
+	go func() { results <- notify(`"world"`) }()
+	//lets the last notification register behind the one in flight
+	for i := 0; i < 100; i++ {
+		mm.sequencer.Lock()
+		pending := mm.sequencer.videos["1234"].pending
+		mm.sequencer.Unlock()
+		if pending == 2 {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	close(release)
+	first, second := <-results, <-results
+
+	if first != resultSent || second != resultSent {
+		t.Errorf("Expected both notifications sent. Actual: [%s] [%s]", first, second)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(sent) != 3 || !strings.Contains(sent[2], "World") || strings.Contains(sent[2], "Brazil") {
+		t.Errorf("Expected the restored tags sent last. Found: [%v]", sent)
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	outboxPut = "put"
+	outboxAck = "ack"
+)
+
+// number of acknowledged entries tolerated in the log before it is rewritten with the pending ones only
+const outboxCompactAfter = 100
+
+type outboxRecord struct {
+	Op      string                             `json:"op"`
+	ID      string                             `json:"id"`
+	TID     string                             `json:"tid,omitempty"`
+	Event   *nativeCmsMetadataPublicationEvent `json:"event,omitempty"`
+	Created time.Time                          `json:"created,omitempty"`
+}
+
+// outbox is an append-only log of accepted notifications which haven't been delivered yet
+type outbox struct {
+	sync.Mutex
+	path    string
+	file    *os.File
+	pending map[string]outboxRecord
+	order   []string
+	acked   int
+}
+
+func openOutbox(path string) (*outbox, error) {
+	ob := &outbox{path: path, pending: make(map[string]outboxRecord)}
+	if err := ob.load(); err != nil {
+		return nil, err
+	}
+	if err := ob.compact(); err != nil {
+		return nil, err
+	}
+	return ob, nil
+}
+
+func (ob *outbox) load() error {
+	f, err := os.Open(ob.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("Opening outbox: [%v]", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var rec outboxRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			//a torn write at the end of the log is expected after a crash
+			warnLogger.Printf("Skipping unreadable outbox record: [%v]", err)
+			continue
+		}
+		switch rec.Op {
+		case outboxPut:
+			ob.pending[rec.ID] = rec
+			ob.order = append(ob.order, rec.ID)
+		case outboxAck:
+			delete(ob.pending, rec.ID)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("Reading outbox: [%v]", err)
+	}
+	return nil
+}
+
+func (ob *outbox) put(id string, tid string, ev *nativeCmsMetadataPublicationEvent) error {
+	ob.Lock()
+	defer ob.Unlock()
+	rec := outboxRecord{Op: outboxPut, ID: id, TID: tid, Event: ev, Created: time.Now().UTC()}
+	if err := ob.write(rec); err != nil {
+		return err
+	}
+	ob.pending[id] = rec
+	ob.order = append(ob.order, id)
+	return nil
+}
+
+func (ob *outbox) ack(id string) error {
+	ob.Lock()
+	defer ob.Unlock()
+	if _, present := ob.pending[id]; !present {
+		return nil
+	}
+	if err := ob.write(outboxRecord{Op: outboxAck, ID: id}); err != nil {
+		return err
+	}
+	delete(ob.pending, id)
+	ob.acked++
+	if ob.acked >= outboxCompactAfter || len(ob.pending) == 0 {
+		return ob.compact()
+	}
+	return nil
+}
+
+// entries returns the pending records in the order they were accepted
+func (ob *outbox) entries() []outboxRecord {
+	ob.Lock()
+	defer ob.Unlock()
+	var recs []outboxRecord
+	for _, id := range ob.order {
+		if rec, present := ob.pending[id]; present {
+			recs = append(recs, rec)
+		}
+	}
+	return recs
+}
+
+func (ob *outbox) write(rec outboxRecord) error {
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("Marshalling outbox record: [%v]", err)
+	}
+	if _, err = ob.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("Writing outbox: [%v]", err)
+	}
+	if err = ob.file.Sync(); err != nil {
+		return fmt.Errorf("Syncing outbox: [%v]", err)
+	}
+	return nil
+}
+
+// compact rewrites the log with the pending records only; must be called with the lock held or before the outbox is shared
+func (ob *outbox) compact() error {
+	tmpPath := ob.path + ".tmp"
+	//the compacted file is opened for appending up front, so the outbox never has to reopen it after the rename
+	tmp, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("Compacting outbox: [%v]", err)
+	}
+	w := bufio.NewWriter(tmp)
+	var order []string
+	for _, id := range ob.order {
+		rec, present := ob.pending[id]
+		if !present {
+			continue
+		}
+		line, err := json.Marshal(rec)
+		if err != nil {
+			tmp.Close()
+			return fmt.Errorf("Compacting outbox: [%v]", err)
+		}
+		w.Write(append(line, '\n'))
+		order = append(order, id)
+	}
+	if err = w.Flush(); err == nil {
+		err = tmp.Sync()
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, ob.path)
+	}
+	if err != nil {
+		//the original log is left in place and stays open
+		tmp.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf("Compacting outbox: [%v]", err)
+	}
+	if ob.file != nil {
+		ob.file.Close()
+	}
+	ob.file = tmp
+	ob.order = order
+	ob.acked = 0
+	return nil
+}
+
+func (mm *metadataMapper) replayOutbox() {
+	recs := mm.outbox.entries()
+	if len(recs) == 0 {
+		return
+	}
+	infoLogger.Printf("Replaying [%d] undelivered notifications from the outbox", len(recs))
+	for _, rec := range recs {
+		n := newNotification(rec.ID, rec.TID, rec.Event)
+		n.Created = rec.Created
+		n.seq = mm.register(n.UUID)
+		//waits for free capacity instead of rejecting, the notifications were already accepted
+		mm.queue.requeue(n)
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOutbox_PendingEntriesSurviveReopen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "outbox")
+	if err != nil {
+		t.Fatalf("[%v]", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "outbox.log")
+
+	ob, err := openOutbox(path)
+	if err != nil {
+		t.Fatalf("Expected no error. Found: [%v]", err)
+	}
+	for _, id := range []string{"id_1", "id_2", "id_3"} {
+		if err := ob.put(id, "tid_"+id, &nativeCmsMetadataPublicationEvent{UUID: "uuid_" + id, Value: "value"}); err != nil {
+			t.Fatalf("Expected no error. Found: [%v]", err)
+		}
+	}
+	if err := ob.ack("id_2"); err != nil {
+		t.Fatalf("Expected no error. Found: [%v]", err)
+	}
+
+	reopened, err := openOutbox(path)
+	if err != nil {
+		t.Fatalf("Expected no error. Found: [%v]", err)
+	}
+	recs := reopened.entries()
+	if len(recs) != 2 {
+		t.Fatalf("Expected pending entries: [2]. Actual: [%d]", len(recs))
+	}
+	if recs[0].ID != "id_1" || recs[1].ID != "id_3" {
+		t.Errorf("Expected entries [id_1 id_3] in order. Actual: [%s %s]", recs[0].ID, recs[1].ID)
+	}
+	if recs[1].Event.UUID != "uuid_id_3" || recs[1].TID != "tid_id_3" {
+		t.Errorf("Unexpected entry: [%+v]", recs[1])
+	}
+}
+
+func TestOutbox_AllAcknowledged_LogCompacted(t *testing.T) {
+	dir, err := ioutil.TempDir("", "outbox")
+	if err != nil {
+		t.Fatalf("[%v]", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "outbox.log")
+
+	ob, err := openOutbox(path)
+	if err != nil {
+		t.Fatalf("Expected no error. Found: [%v]", err)
+	}
+	ob.put("id_1", "tid_1", &nativeCmsMetadataPublicationEvent{UUID: "1234"})
+	ob.ack("id_1")
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("[%v]", err)
+	}
+	if fi.Size() != 0 {
+		t.Errorf("Expected empty outbox after compaction. Actual size: [%d]", fi.Size())
+	}
+}
+
+func TestOutbox_CompactionFails_OutboxStillWritable(t *testing.T) {
+	dir, err := ioutil.TempDir("", "outbox")
+	if err != nil {
+		t.Fatalf("[%v]", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "outbox.log")
+
+	ob, err := openOutbox(path)
+	if err != nil {
+		t.Fatalf("Expected no error. Found: [%v]", err)
+	}
+	//a non-empty directory in place of the log makes the rename fail
+	os.Remove(path)
+	if err = os.MkdirAll(filepath.Join(path, "blocker"), 0755); err != nil {
+		t.Fatalf("[%v]", err)
+	}
+	if err = ob.compact(); err == nil {
+		t.Fatal("Expected compaction to fail")
+	}
+	if err = ob.put("id_1", "tid_1", &nativeCmsMetadataPublicationEvent{UUID: "1234"}); err != nil {
+		t.Errorf("Expected no error. Found: [%v]", err)
+	}
+	if _, err = os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("Expected the temporary file to be removed. Found: [%v]", err)
+	}
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/Financial-Times/transactionid-utils-go"
+	"github.com/gorilla/mux"
+)
+
+const ruleOverride = "override"
+
+// how many videos without override have their last tags and custom fields remembered, for an override set later to be applied at once
+const maxRememberedVideos = 10000
+
+// result of an override change whose video wasn't notified yet
+const resultNotSent = "not sent"
+
+// override adds terms to and removes TME IDs from the annotations of a video, regardless of its tags
+type override struct {
+	UUID         string            `json:"uuid"`
+	Add          []term            `json:"add"`
+	Remove       []string          `json:"remove"`
+	Tags         []string          `json:"tags,omitempty"`
+	CustomFields map[string]string `json:"customFields,omitempty"`
+	Updated      time.Time         `json:"updated"`
+}
+
+// overrideStore keeps the overrides in a JSON file when a path is configured, along with the last tags and custom fields of
+// the videos
+type overrideStore struct {
+	sync.RWMutex
+	path      string
+	overrides map[string]*override
+	videos    map[string]video
+	order     []string
+}
+
+func newOverrideStore(path string) (*overrideStore, error) {
+	s := &overrideStore{path: path, overrides: make(map[string]*override), videos: make(map[string]video)}
+	if path == "" {
+		return s, nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Reading overrides: [%v]", err)
+	}
+	var overrides []*override
+	if err = json.Unmarshal(data, &overrides); err != nil {
+		return nil, fmt.Errorf("Decoding overrides: [%v]", err)
+	}
+	for _, o := range overrides {
+		s.overrides[o.UUID] = o
+	}
+	return s, nil
+}
+
+func (s *overrideStore) get(uuid string) (override, bool) {
+	s.RLock()
+	defer s.RUnlock()
+	o, present := s.overrides[uuid]
+	if !present {
+		return override{}, false
+	}
+	return *o, true
+}
+
+// put stores the override with the tags and custom fields last received for the video, if any; an override of a video
+// not notified yet is applied on its first notification
+func (s *overrideStore) put(o override) (override, error) {
+	s.Lock()
+	defer s.Unlock()
+	o.Tags, o.CustomFields = nil, nil
+	if existing, present := s.overrides[o.UUID]; present && (existing.Tags != nil || existing.CustomFields != nil) {
+		o.Tags, o.CustomFields = existing.Tags, existing.CustomFields
+	} else if v, known := s.videos[o.UUID]; known {
+		o.Tags, o.CustomFields = v.Tags, v.CustomFields
+	}
+	o.Updated = time.Now().UTC()
+	previous, present := s.overrides[o.UUID]
+	s.overrides[o.UUID] = &o
+	if err := s.persist(); err != nil {
+		if present {
+			s.overrides[o.UUID] = previous
+		} else {
+			delete(s.overrides, o.UUID)
+		}
+		return override{}, err
+	}
+	return o, nil
+}
+
+// remove returns the removed override
+func (s *overrideStore) remove(uuid string) (override, bool, error) {
+	s.Lock()
+	defer s.Unlock()
+	o, present := s.overrides[uuid]
+	if !present {
+		return override{}, false, nil
+	}
+	delete(s.overrides, uuid)
+	if err := s.persist(); err != nil {
+		s.overrides[uuid] = o
+		return override{}, false, err
+	}
+	if o.Tags != nil || o.CustomFields != nil {
+		s.rememberLocked(video{UUID: uuid, Tags: o.Tags, CustomFields: o.CustomFields})
+	}
+	return *o, true, nil
+}
+
+// rememberVideo records the last tags and custom fields received for a video
+func (s *overrideStore) rememberVideo(v video) error {
+	s.Lock()
+	defer s.Unlock()
+	if o, present := s.overrides[v.UUID]; present {
+		o.Tags, o.CustomFields = v.Tags, v.CustomFields
+		if o.Tags == nil {
+			o.Tags = []string{}
+		}
+		return s.persist()
+	}
+	s.rememberLocked(v)
+	return nil
+}
+
+func (s *overrideStore) rememberLocked(v video) {
+	if _, present := s.videos[v.UUID]; !present {
+		s.order = append(s.order, v.UUID)
+	}
+	s.videos[v.UUID] = v
+	for len(s.order) > maxRememberedVideos {
+		delete(s.videos, s.order[0])
+		s.order = s.order[1:]
+	}
+}
+
+// lastVideo returns the last tags and custom fields received for a video, if any
+func (s *overrideStore) lastVideo(uuid string) (video, bool) {
+	s.RLock()
+	defer s.RUnlock()
+	if o, present := s.overrides[uuid]; present && (o.Tags != nil || o.CustomFields != nil) {
+		return video{UUID: uuid, Tags: o.Tags, CustomFields: o.CustomFields}, true
+	}
+	v, present := s.videos[uuid]
+	return v, present
+}
+
+// persist rewrites the overrides file; must be called with the lock held
+func (s *overrideStore) persist() error {
+	if s.path == "" {
+		return nil
+	}
+	overrides := make([]*override, 0, len(s.overrides))
+	for _, o := range s.overrides {
+		overrides = append(overrides, o)
+	}
+	data, err := json.Marshal(overrides)
+	if err != nil {
+		return fmt.Errorf("Marshalling overrides: [%v]", err)
+	}
+	tmp := s.path + ".tmp"
+	if err = ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("Writing overrides: [%v]", err)
+	}
+	if err = os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("Writing overrides: [%v]", err)
+	}
+	return nil
+}
+
+// validate completes the added terms from their TME ID
+func (o *override) validate(defaultPredicates map[string]string) error {
+	o.Remove = trimAll(o.Remove)
+	for i, t := range o.Add {
+		if t.ID == "" {
+			return fmt.Errorf("Missing id of added term: [%+v]", t)
+		}
+		taxonomy, err := decodeTaxonomy(t.ID)
+		if err != nil {
+			return err
+		}
+		if t.Predicate != "" {
+			if err = validatePredicate(t.Predicate); err != nil {
+				return err
+			}
+		}
+		if t.CanonicalName == "" {
+			t.CanonicalName = t.ID
+		}
+		t.Taxonomy = taxonomy
+		t.UUID, t.Score = "", nil
+		applyDefaultPredicate(&t, defaultPredicates)
+		t.Provenance = &provenance{Rule: ruleOverride}
+		o.Add[i] = t
+	}
+	if o.Add == nil {
+		o.Add = []term{}
+	}
+	if o.Remove == nil {
+		o.Remove = []string{}
+	}
+	return nil
+}
+
+// apply removes the terms of the removed TME IDs, then adds the added terms which aren't there yet
+func (o override) apply(terms []term) []term {
+	removed := make(map[string]bool)
+	for _, id := range o.Remove {
+		removed[id] = true
+	}
+	var applied []term
+	present := make(map[string]bool)
+	for _, t := range terms {
+		if removed[t.ID] {
+			continue
+		}
+		applied = append(applied, t)
+		present[t.ID] = true
+	}
+	for _, t := range o.Add {
+		if !present[t.ID] {
+			applied = append(applied, t)
+			present[t.ID] = true
+		}
+	}
+	return applied
+}
+
+func (mm *metadataMapper) rememberVideo(v video, tid string) {
+	if mm.overrides == nil {
+		return
+	}
+	if err := mm.overrides.rememberVideo(v); err != nil {
+		errorLogger.Printf("tid=[%s]. Remembering the tags of video=[%s]: %v", tid, v.UUID, err)
+	}
+}
+
+type overrideResponse struct {
+	Override override `json:"override"`
+	Result   string   `json:"result"`
+	ID       string   `json:"id,omitempty"`
+}
+
+func (mm *metadataMapper) handleGetOverride(w http.ResponseWriter, r *http.Request) {
+	uuid := mux.Vars(r)["uuid"]
+	o, present := mm.overrides.get(uuid)
+	if !present {
+		handleErr(w, http.StatusNotFound, fmt.Sprintf("No override for video=[%s]", uuid))
+		return
+	}
+	writeJSON(w, http.StatusOK, o)
+}
+
+func (mm *metadataMapper) handlePutOverride(w http.ResponseWriter, r *http.Request) {
+	tid := transactionidutils.GetTransactionIDFromRequest(r)
+	uuid := mux.Vars(r)["uuid"]
+	var o override
+	if err := json.NewDecoder(r.Body).Decode(&o); err != nil {
+		clientErr(w, tid, fmt.Sprintf("Cannot decode override: [%v]", err))
+		return
+	}
+	o.UUID = uuid
+	if err := o.validate(mm.config.defaultPredicates); err != nil {
+		clientErr(w, tid, err.Error())
+		return
+	}
+	o, err := mm.overrides.put(o)
+	if err != nil {
+		internalErr(w, tid, err)
+		return
+	}
+	infoLogger.Printf("tid=[%s]. Override of video=[%s] set: adding [%d] terms, removing [%d]", tid, uuid, len(o.Add), len(o.Remove))
+	resp := overrideResponse{Override: o}
+	if resp.Result, resp.ID, err = mm.resend(uuid, tid); err != nil {
+		publishErr(w, tid, uuid, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (mm *metadataMapper) handleDeleteOverride(w http.ResponseWriter, r *http.Request) {
+	tid := transactionidutils.GetTransactionIDFromRequest(r)
+	uuid := mux.Vars(r)["uuid"]
+	_, removed, err := mm.overrides.remove(uuid)
+	if err != nil {
+		internalErr(w, tid, err)
+		return
+	}
+	if !removed {
+		handleErr(w, http.StatusNotFound, fmt.Sprintf("tid=[%s]. No override for video=[%s]", tid, uuid))
+		return
+	}
+	infoLogger.Printf("tid=[%s]. Override of video=[%s] removed", tid, uuid)
+	if _, _, err = mm.resend(uuid, tid); err != nil {
+		publishErr(w, tid, uuid, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// resend sends the metadata of a video again, from its last tags and custom fields, once its override changed
+func (mm *metadataMapper) resend(uuid string, tid string) (string, string, error) {
+	v, known := mm.overrides.lastVideo(uuid)
+	if !known {
+		infoLogger.Printf("tid=[%s]. Video=[%s] wasn't notified yet, nothing to send again", tid, uuid)
+		return resultNotSent, "", nil
+	}
+	resp, err := mm.publish(v, tid, false)
+	if err != nil {
+		return "", "", err
+	}
+	infoLogger.Printf("tid=[%s]. Metadata of video=[%s] published again after its override changed: [%s]", tid, uuid, resp.Result)
+	return resp.Result, resp.ID, nil
+}
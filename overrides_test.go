@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func TestOverride_Apply_TermsRemovedAndAdded(t *testing.T) {
+	o := override{
+		Add:    []term{{CanonicalName: "Brazil", ID: "QnJhemls-UmVnaW9ucw=="}, {CanonicalName: "World", ID: "MQ==-U2VjdGlvbnM="}},
+		Remove: []string{"Mjk=-U2VjdGlvbnM="},
+	}
+	terms := []term{{CanonicalName: "World", ID: "MQ==-U2VjdGlvbnM="}, {CanonicalName: "Companies", ID: "Mjk=-U2VjdGlvbnM="}}
+
+	applied := o.apply(terms)
+
+	if len(applied) != 2 || applied[0].ID != "MQ==-U2VjdGlvbnM=" || applied[1].ID != "QnJhemls-UmVnaW9ucw==" {
+		t.Errorf("Unexpected terms: [%+v]", applied)
+	}
+}
+
+func TestOverrideStore_PersistedAndReloaded(t *testing.T) {
+	dir, err := ioutil.TempDir("", "overrides")
+	if err != nil {
+		t.Fatalf("[%v]", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "overrides.json")
+	s, err := newOverrideStore(path)
+	if err != nil {
+		t.Fatalf("[%v]", err)
+	}
+	s.rememberVideo(video{UUID: "1234", Tags: []string{"world"}})
+	if _, err = s.put(override{UUID: "1234", Remove: []string{"MQ==-U2VjdGlvbnM="}}); err != nil {
+		t.Fatalf("[%v]", err)
+	}
+
+	reloaded, err := newOverrideStore(path)
+	if err != nil {
+		t.Fatalf("[%v]", err)
+	}
+	o, present := reloaded.get("1234")
+	if !present || len(o.Remove) != 1 || len(o.Tags) != 1 {
+		t.Errorf("Expected the override with the tags of the video. Found: [%+v]", o)
+	}
+}
+
+func TestHandlePutOverride_KnownVideo_Resent(t *testing.T) {
+	var sent []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var ev nativeCmsMetadataPublicationEvent
+		json.NewDecoder(r.Body).Decode(&ev)
+		value, _ := base64.StdEncoding.DecodeString(ev.Value)
+		sent = append(sent, string(value))
+	}))
+	defer ts.Close()
+	overrides, _ := newOverrideStore("")
+	mm := metadataMapper{
+		config:    &notifierConfig{cmsMetadataNotifierAddr: ts.URL},
+		client:    &http.Client{},
+		mappings:  map[string]term{"world": {CanonicalName: "World", ID: "MQ==-U2VjdGlvbnM=", Taxonomy: "Sections"}},
+		overrides: overrides,
+	}
+	r := mux.NewRouter()
+	r.HandleFunc("/notify", mm.handleNotification).Methods("POST")
+	r.HandleFunc("/videos/{uuid}/overrides", mm.handlePutOverride).Methods("PUT")
+	r.HandleFunc("/videos/{uuid}/overrides", mm.handleDeleteOverride).Methods("DELETE")
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("PUT", "/videos/1234/overrides", strings.NewReader(`{"add":[{"id":"QnJhemls-UmVnaW9ucw==","canonicalName":"Brazil"}]}`)))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"result":"not sent"`) || len(sent) != 0 {
+		t.Fatalf("Expected the override of a video not notified yet kept without sending. Found: [%d] [%s]", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("POST", "/notify", strings.NewReader(`{"uuid":"1234","tags":["world"]}`)))
+	if len(sent) != 1 || !strings.Contains(sent[0], "World") || !strings.Contains(sent[0], "Brazil") {
+		t.Fatalf("Expected the notification sent with the override applied. Found: [%v]", sent)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("PUT", "/videos/1234/overrides", strings.NewReader(`{"add":[{"id":"QnJhemls-UmVnaW9ucw==","canonicalName":"Brazil"}],"remove":["MQ==-U2VjdGlvbnM="],"tags":["other"]}`)))
+	if w.Code != http.StatusOK || len(sent) != 2 || !strings.Contains(sent[1], "Brazil") || strings.Contains(sent[1], "World") {
+		t.Fatalf("Expected a re-send with Brazil and without World. Found: [%d] [%v]", w.Code, sent)
+	}
+	if o, _ := overrides.get("1234"); len(o.Tags) != 1 || o.Tags[0] != "world" {
+		t.Errorf("Expected the tags from the body ignored. Actual: [%v]", o.Tags)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("DELETE", "/videos/1234/overrides", nil))
+	if w.Code != http.StatusNoContent || len(sent) != 3 || !strings.Contains(sent[2], "World") || strings.Contains(sent[2], "Brazil") {
+		t.Errorf("Expected a re-send with the tags only. Found: [%d] [%v]", w.Code, sent)
+	}
+}
+
+func TestHandlePutOverride_InvalidTerm_BadRequest(t *testing.T) {
+	overrides, _ := newOverrideStore("")
+	mm := metadataMapper{config: &notifierConfig{}, overrides: overrides}
+	r := mux.NewRouter()
+	r.HandleFunc("/videos/{uuid}/overrides", mm.handlePutOverride).Methods("PUT")
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("PUT", "/videos/1234/overrides", strings.NewReader(`{"add":[{"id":"notaxonomy"}]}`)))
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code: [%d]. Actual: [%d]", http.StatusBadRequest, w.Code)
+	}
+}
+
+func TestHandlePutOverride_ResentLikeNotification_HitsRecordedAndUnchangedSkipped(t *testing.T) {
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+	}))
+	defer ts.Close()
+	overrides, _ := newOverrideStore("")
+	hits, _ := newMappingHits("")
+	sent, _ := newSentStore(time.Hour, "")
+	mm := metadataMapper{
+		config:    &notifierConfig{cmsMetadataNotifierAddr: ts.URL},
+		client:    &http.Client{},
+		mappings:  map[string]term{"world": {CanonicalName: "World", ID: "MQ==-U2VjdGlvbnM=", Taxonomy: "Sections"}},
+		overrides: overrides,
+		hits:      hits,
+		sent:      sent,
+	}
+	r := mux.NewRouter()
+	r.HandleFunc("/notify", mm.handleNotification).Methods("POST")
+	r.HandleFunc("/videos/{uuid}/overrides", mm.handlePutOverride).Methods("PUT")
+
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/notify", strings.NewReader(`{"uuid":"1234","tags":["world"]}`)))
+	for _, expected := range []string{resultSent, resultNoChange} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("PUT", "/videos/1234/overrides", strings.NewReader(`{"add":[{"id":"QnJhemls-UmVnaW9ucw==","canonicalName":"Brazil"}]}`)))
+		if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"result":"`+expected+`"`) {
+			t.Errorf("Expected result: [%s]. Found: [%d] [%s]", expected, w.Code, w.Body.String())
+		}
+	}
+
+	if requests != 2 {
+		t.Errorf("Expected requests: [2]. Actual: [%d]", requests)
+	}
+	if hit, _ := hits.get("world"); hit.Count != 3 {
+		t.Errorf("Expected the mapping hits of every resend recorded. Actual count: [%d]", hit.Count)
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	predicateAbout                   = "about"
+	predicateMajorMentions           = "majorMentions"
+	predicateMentions                = "mentions"
+	predicateIsClassifiedBy          = "isClassifiedBy"
+	predicateIsPrimarilyClassifiedBy = "isPrimarilyClassifiedBy"
+	predicateHasAuthor               = "hasAuthor"
+)
+
+var allowedPredicates = map[string]bool{
+	predicateAbout:                   true,
+	predicateMajorMentions:           true,
+	predicateMentions:                true,
+	predicateIsClassifiedBy:          true,
+	predicateIsPrimarilyClassifiedBy: true,
+	predicateHasAuthor:               true,
+}
+
+// classifying taxonomies; the concepts of the other taxonomies are mentioned
+var classificationTaxonomies = map[string]bool{
+	"Sections":       true,
+	"Genres":         true,
+	"Brands":         true,
+	"Subjects":       true,
+	"SpecialReports": true,
+}
+
+func defaultPredicate(taxonomy string) string {
+	if classificationTaxonomies[taxonomy] {
+		return predicateIsClassifiedBy
+	}
+	return predicateMentions
+}
+
+// predicateOf falls back to the built-in default for terms not loaded from the sheet
+func predicateOf(t term) string {
+	if t.Predicate != "" {
+		return t.Predicate
+	}
+	return defaultPredicate(t.Taxonomy)
+}
+
+func validatePredicate(predicate string) error {
+	if !allowedPredicates[predicate] {
+		return fmt.Errorf("Unknown predicate: [%s]", predicate)
+	}
+	return nil
+}
+
+// parseDefaultPredicates reads the default predicates per taxonomy from a list like "Sections=isClassifiedBy,Authors=hasAuthor"
+func parseDefaultPredicates(value string) (map[string]string, error) {
+	defaults := make(map[string]string)
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" {
+			return nil, fmt.Errorf("Invalid default predicate, expected taxonomy=predicate: [%s]", pair)
+		}
+		predicate := strings.TrimSpace(kv[1])
+		if err := validatePredicate(predicate); err != nil {
+			return nil, err
+		}
+		defaults[strings.TrimSpace(kv[0])] = predicate
+	}
+	return defaults, nil
+}
+
+// applyDefaultPredicate sets the predicate of a term whose sheet row didn't have one
+func applyDefaultPredicate(t *term, defaults map[string]string) {
+	if t.Predicate != "" {
+		return
+	}
+	if predicate, present := defaults[t.Taxonomy]; present {
+		t.Predicate = predicate
+		return
+	}
+	t.Predicate = defaultPredicate(t.Taxonomy)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/Financial-Times/transactionid-utils-go"
+)
+
+// metadataPreview shows what would be sent for a video, without sending it
+type metadataPreview struct {
+	UUID         string                            `json:"uuid"`
+	ContentRef   string                            `json:"contentRef,omitempty"`
+	Annotations  json.RawMessage                   `json:"annotations,omitempty"`
+	Event        nativeCmsMetadataPublicationEvent `json:"event"`
+	Terms        []term                            `json:"terms"`
+	UnmappedTags []string                          `json:"unmappedTags"`
+	IgnoredTags  []string                          `json:"ignoredTags"`
+	Suggestions  map[string][]suggestion           `json:"suggestions"`
+}
+
+func (mm *metadataMapper) handlePreview(w http.ResponseWriter, r *http.Request) {
+	tid := transactionidutils.GetTransactionIDFromRequest(r)
+	v, ok := decodeVideo(w, r, tid)
+	if !ok {
+		return
+	}
+	mm.preview(w, r, v, tid)
+}
+
+// preview supports ?format= to compare the output formats regardless of the configured one
+func (mm *metadataMapper) preview(w http.ResponseWriter, r *http.Request, v video, tid string) {
+	f := mm.formatter()
+	if format := r.URL.Query().Get("format"); format != "" {
+		var err error
+		if f, err = newFormatter(format, mm.conceptIDs(), mm.config != nil && mm.config.xmlTagPredicates); err != nil {
+			clientErr(w, tid, err.Error())
+			return
+		}
+	}
+	a := mm.annotate(v, tid)
+	var err error
+	if a.Terms, err = mm.resolveConcepts(a.Terms, tid); err != nil {
+		concordanceErr(w, tid, err)
+		return
+	}
+	ev, err := newMetadataPublishEvent(f, v.UUID, a.Terms, tid)
+	if err != nil {
+		internalErr(w, tid, err)
+		return
+	}
+	payload, err := base64.StdEncoding.DecodeString(ev.Value)
+	if err != nil {
+		internalErr(w, tid, fmt.Errorf("Decoding event value: [%v]", err))
+		return
+	}
+	p := metadataPreview{
+		UUID:         v.UUID,
+		Event:        *ev,
+		Terms:        a.Terms,
+		UnmappedTags: a.Unmapped,
+		IgnoredTags:  a.Ignored,
+		Suggestions:  mm.suggestions(a.Unmapped),
+	}
+	if _, ok := f.(contentRefFormatter); ok {
+		p.ContentRef = string(payload)
+	} else {
+		p.Annotations = json.RawMessage(payload)
+	}
+	if p.Terms == nil {
+		p.Terms = []term{}
+	}
+	if p.UnmappedTags == nil {
+		p.UnmappedTags = []string{}
+	}
+	if p.IgnoredTags == nil {
+		p.IgnoredTags = []string{}
+	}
+	infoLogger.Printf("Previewed metadata for video=[%s] tid=[%s]", v.UUID, tid)
+	writeJSON(w, http.StatusOK, p)
+}
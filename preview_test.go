@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandleNotification_DryRun_PreviewReturnedAndNothingSent(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("Expected nothing sent to cms-metadata-notifier.")
+	}))
+	defer ts.Close()
+	mm := metadataMapper{
+		config: &notifierConfig{cmsMetadataNotifierAddr: ts.URL},
+		client: &http.Client{},
+		mappings: map[string]term{
+			"commodities": term{
+				CanonicalName: "Commodities",
+				ID:            "MTA1-U2VjdGlvbnM=",
+				Taxonomy:      "Sections",
+			},
+		},
+	}
+	body := `{"uuid" : "1234", "tags" : ["Commodities", "unknown"]}`
+
+	req, _ := http.NewRequest("POST", "/notify?dryRun=true", bytes.NewReader([]byte(body)))
+	w := httptest.NewRecorder()
+	mm.handleNotification(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code: [%d]. Actual: [%d]", http.StatusOK, w.Code)
+	}
+	var p metadataPreview
+	if err := json.NewDecoder(w.Body).Decode(&p); err != nil {
+		t.Fatalf("[%v]", err)
+	}
+	expectedContentRef := `<contentRef><tags><tag><term taxonomy="Sections" id="MTA1-U2VjdGlvbnM="><canonicalName>Commodities</canonicalName></term><score confidence="90" relevance="90"></score></tag></tags><primarySection taxonomy="" id=""></primarySection></contentRef>`
+	if p.ContentRef != expectedContentRef {
+		t.Errorf("Expected: [%s]. Actual: [%s]", expectedContentRef, p.ContentRef)
+	}
+	if len(p.Terms) != 1 || p.Terms[0].ID != "MTA1-U2VjdGlvbnM=" {
+		t.Errorf("Unexpected terms: [%+v]", p.Terms)
+	}
+	if len(p.UnmappedTags) != 1 || p.UnmappedTags[0] != "unknown" {
+		t.Errorf("Unexpected unmapped tags: [%+v]", p.UnmappedTags)
+	}
+	if p.Event.UUID != "1234" || p.Event.Value == "" {
+		t.Errorf("Unexpected event: [%+v]", p.Event)
+	}
+}
+
+func TestPreview_TermsCarryProvenanceNotSentInXML(t *testing.T) {
+	mm := metadataMapper{
+		mappingVersion: "v1",
+		mappings: map[string]term{
+			"commodities": term{
+				CanonicalName: "Commodities",
+				ID:            "MTA1-U2VjdGlvbnM=",
+				Taxonomy:      "Sections",
+				Provenance:    &provenance{Row: 7, MappingVersion: "v1"},
+			},
+		},
+	}
+	req, _ := http.NewRequest("POST", "/preview", bytes.NewReader([]byte(`{"uuid" : "1234", "tags" : ["Commodities"]}`)))
+	w := httptest.NewRecorder()
+	mm.handlePreview(w, req)
+
+	var p metadataPreview
+	if err := json.NewDecoder(w.Body).Decode(&p); err != nil {
+		t.Fatalf("[%v]", err)
+	}
+	if len(p.Terms) != 1 || p.Terms[0].Provenance == nil {
+		t.Fatalf("Expected a term with provenance. Actual: [%+v]", p.Terms)
+	}
+	expected := provenance{SourceTag: "Commodities", Key: "commodities", Rule: ruleExact, Row: 7, MappingVersion: "v1"}
+	if *p.Terms[0].Provenance != expected {
+		t.Errorf("Expected: [%+v]. Actual: [%+v]", expected, *p.Terms[0].Provenance)
+	}
+	if strings.Contains(p.ContentRef, "provenance") || strings.Contains(p.ContentRef, "Row") {
+		t.Errorf("Expected no provenance in the contentRef. Actual: [%s]", p.ContentRef)
+	}
+	if mm.mappings["commodities"].Provenance.SourceTag != "" {
+		t.Error("Expected the loaded mapping to be left unchanged.")
+	}
+}
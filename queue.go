@@ -0,0 +1,173 @@
+package main
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	statusQueued     = "queued"
+	statusInProgress = "in-progress"
+	statusDelivered  = "delivered"
+	statusFailed     = "failed"
+	statusNoChange   = "no change"
+)
+
+// upper bound of notification statuses kept for GET /notify/{id}; the oldest are dropped first
+const maxTrackedNotifications = 10000
+
+var errQueueFull = errors.New("Notification queue is full")
+
+type notification struct {
+	ID      string    `json:"id"`
+	TID     string    `json:"tid"`
+	UUID    string    `json:"uuid"`
+	Status  string    `json:"status"`
+	Error   string    `json:"error,omitempty"`
+	Created time.Time `json:"created"`
+	Updated time.Time `json:"updated"`
+	event   *nativeCmsMetadataPublicationEvent
+	seq     uint64
+	force   bool
+}
+
+type notificationQueue struct {
+	sync.RWMutex
+	jobs     chan *notification
+	statuses map[string]*notification
+	order    []string
+}
+
+func newNotificationQueue(size int) *notificationQueue {
+	return &notificationQueue{
+		jobs:     make(chan *notification, size),
+		statuses: make(map[string]*notification),
+	}
+}
+
+func newNotification(id string, tid string, ev *nativeCmsMetadataPublicationEvent) *notification {
+	now := time.Now().UTC()
+	return &notification{ID: id, TID: tid, UUID: ev.UUID, Status: statusQueued, Created: now, Updated: now, event: ev}
+}
+
+func (q *notificationQueue) enqueue(n *notification) error {
+	q.Lock()
+	defer q.Unlock()
+	select {
+	case q.jobs <- n:
+	default:
+		return errQueueFull
+	}
+	q.track(n)
+	return nil
+}
+
+// hold tracks a notification which is kept back before being queued
+func (q *notificationQueue) hold(n *notification) {
+	q.Lock()
+	defer q.Unlock()
+	q.track(n)
+}
+
+// requeue blocks until there is room in the queue
+func (q *notificationQueue) requeue(n *notification) {
+	q.Lock()
+	if _, present := q.statuses[n.ID]; !present {
+		q.track(n)
+	}
+	q.Unlock()
+	q.jobs <- n
+}
+
+func (q *notificationQueue) track(n *notification) {
+	q.statuses[n.ID] = n
+	q.order = append(q.order, n.ID)
+	if len(q.order) > maxTrackedNotifications {
+		delete(q.statuses, q.order[0])
+		q.order = q.order[1:]
+	}
+}
+
+func (q *notificationQueue) setStatus(id string, status string, errMsg string) {
+	q.Lock()
+	defer q.Unlock()
+	n, present := q.statuses[id]
+	if !present {
+		return
+	}
+	n.Status = status
+	n.Error = errMsg
+	n.Updated = time.Now().UTC()
+}
+
+func (q *notificationQueue) status(id string) (notification, bool) {
+	q.RLock()
+	defer q.RUnlock()
+	n, present := q.statuses[id]
+	if !present {
+		return notification{}, false
+	}
+	return *n, true
+}
+
+func (mm *metadataMapper) startWorkers(count int) {
+	for i := 0; i < count; i++ {
+		go mm.work()
+	}
+	infoLogger.Printf("Started [%d] notification workers. Queue capacity: [%d]", count, cap(mm.queue.jobs))
+}
+
+func (mm *metadataMapper) work() {
+	for n := range mm.queue.jobs {
+		mm.queue.setStatus(n.ID, statusInProgress, "")
+		result, err := mm.sendInOrder(n.event, n.TID, n.seq, n.force)
+		//a failed delivery stays in the outbox, to be sent again on restart, unless it's safe on disk as a dead letter
+		if err == nil || isDeadLettered(err) {
+			mm.ackOutbox(n)
+		}
+		switch result {
+		case resultSuperseded:
+			infoLogger.Printf("tid=[%s]. Skipped notification=[%s], a newer one for video=[%s] was received", n.TID, n.ID, n.UUID)
+			mm.queue.setStatus(n.ID, statusSuperseded, "")
+			continue
+		case resultNoChange:
+			infoLogger.Printf("tid=[%s]. Skipped notification=[%s], the metadata of video=[%s] didn't change since last sent", n.TID, n.ID, n.UUID)
+			mm.queue.setStatus(n.ID, statusNoChange, "")
+			continue
+		}
+		if err != nil {
+			warnLogger.Printf("tid=[%s]. Delivery failed for notification=[%s]: %v", n.TID, n.ID, err)
+			mm.queue.setStatus(n.ID, statusFailed, err.Error())
+			continue
+		}
+		mm.queue.setStatus(n.ID, statusDelivered, "")
+		infoLogger.Printf("Sent metadata event for video=[%s] notification=[%s] tid=[%s]", n.UUID, n.ID, n.TID)
+	}
+}
+
+func (mm *metadataMapper) ackOutbox(n *notification) {
+	if mm.outbox == nil {
+		return
+	}
+	if err := mm.outbox.ack(n.ID); err != nil {
+		errorLogger.Printf("tid=[%s]. Acknowledging notification=[%s] in the outbox: %v", n.TID, n.ID, err)
+	}
+}
+
+func isDeadLettered(err error) bool {
+	de, ok := err.(*deliveryError)
+	return ok && de.deadLettered
+}
+
+func newTrackingID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("Generating tracking id: [%v]", err)
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func TestEnqueue_QueueFull_ErrQueueFullReturned(t *testing.T) {
+	q := newNotificationQueue(1)
+
+	ev := &nativeCmsMetadataPublicationEvent{UUID: "1234"}
+	if err := q.enqueue(newNotification("id_1", "tid_1", ev)); err != nil {
+		t.Fatalf("Expected no error. Found: [%v]", err)
+	}
+	if err := q.enqueue(newNotification("id_2", "tid_2", ev)); err != errQueueFull {
+		t.Errorf("Expected: [%v]. Actual: [%v]", errQueueFull, err)
+	}
+}
+
+func TestHandleNotification_AsyncMode_AcceptedAndQueueFullStatusCodes(t *testing.T) {
+	mm := metadataMapper{queue: newNotificationQueue(1), mappings: map[string]term{}}
+	body := `{"uuid" : "1a78d8e7-473d-4e9f-ae2e-7f20a45e31fc", "tags" : []}`
+
+	for _, expected := range []int{http.StatusAccepted, http.StatusTooManyRequests} {
+		w := httptest.NewRecorder()
+		req, err := http.NewRequest("POST", "/notify", bytes.NewReader([]byte(body)))
+		if err != nil {
+			t.Fatalf("[%v]", err)
+		}
+		mm.handleNotification(w, req)
+		if w.Code != expected {
+			t.Errorf("Expected status code: [%d]. Actual: [%d]", expected, w.Code)
+		}
+	}
+}
+
+func TestWork_DeliveredNotificationStatusReported(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+	mm := metadataMapper{
+		config: &notifierConfig{cmsMetadataNotifierAddr: ts.URL},
+		client: &http.Client{},
+		queue:  newNotificationQueue(10),
+	}
+	mm.startWorkers(1)
+
+	n := newNotification("id_1", "tid_1", &nativeCmsMetadataPublicationEvent{UUID: "1234"})
+	if err := mm.queue.enqueue(n); err != nil {
+		t.Fatalf("Expected no error. Found: [%v]", err)
+	}
+
+	r := mux.NewRouter()
+	r.HandleFunc("/notify/{id}", mm.handleNotificationStatus)
+	var actual notification
+	for i := 0; i < 50; i++ {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/notify/"+n.ID, nil)
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status code: [%d]. Actual: [%d]", http.StatusOK, w.Code)
+		}
+		if err := json.NewDecoder(w.Body).Decode(&actual); err != nil {
+			t.Fatalf("[%v]", err)
+		}
+		if actual.Status == statusDelivered {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Errorf("Expected status: [%s]. Actual: [%s]", statusDelivered, actual.Status)
+}
+
+func TestHandleNotificationStatus_UnknownID_NotFoundErrorResponse(t *testing.T) {
+	mm := metadataMapper{queue: newNotificationQueue(10)}
+	r := mux.NewRouter()
+	r.HandleFunc("/notify/{id}", mm.handleNotificationStatus)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/notify/id_1", nil)
+	req.Header.Set("X-Request-Id", "tid_1")
+	r.ServeHTTP(w, req)
+
+	var actual errorResponse
+	if err := json.NewDecoder(w.Body).Decode(&actual); err != nil {
+		t.Fatalf("[%v]", err)
+	}
+	if w.Code != http.StatusNotFound || actual.Code != errCodeNotFound || actual.TID != "tid_1" || actual.Retryable {
+		t.Errorf("Unexpected response: [%d] [%+v]", w.Code, actual)
+	}
+}
+
+func TestWork_FailedDeliveryNotDeadLetteredToDisk_KeptInOutbox(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer ts.Close()
+	dir, err := ioutil.TempDir("", "outbox")
+	if err != nil {
+		t.Fatalf("[%v]", err)
+	}
+	defer os.RemoveAll(dir)
+	ob, err := openOutbox(filepath.Join(dir, "outbox.log"))
+	if err != nil {
+		t.Fatalf("Expected no error. Found: [%v]", err)
+	}
+	deadLetters, _ := newDeadLetterStore("", 0)
+	mm := metadataMapper{
+		config:      &notifierConfig{cmsMetadataNotifierAddr: ts.URL},
+		client:      &http.Client{},
+		queue:       newNotificationQueue(10),
+		outbox:      ob,
+		deadLetters: deadLetters,
+	}
+	mm.startWorkers(1)
+
+	ev := &nativeCmsMetadataPublicationEvent{UUID: "1234", Value: "value"}
+	if err = ob.put("id_1", "tid_1", ev); err != nil {
+		t.Fatalf("Expected no error. Found: [%v]", err)
+	}
+	if err = mm.queue.enqueue(newNotification("id_1", "tid_1", ev)); err != nil {
+		t.Fatalf("Expected no error. Found: [%v]", err)
+	}
+	for i := 0; i < 50; i++ {
+		if n, _ := mm.queue.status("id_1"); n.Status == statusFailed {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if recs := ob.entries(); len(recs) != 1 {
+		t.Errorf("Expected the failed notification to stay in the outbox. Pending entries: [%d]", len(recs))
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+)
+
+const (
+	resultSent       = "sent"
+	resultNoChange   = statusNoChange
+	resultQueued     = statusQueued
+	resultSuperseded = statusSuperseded
+)
+
+const (
+	errCodeInvalidRequest        = "invalid_request"
+	errCodeNotFound              = "not_found"
+	errCodeQueueFull             = "queue_full"
+	errCodeDownstreamError       = "downstream_error"
+	errCodeDownstreamTimeout     = "downstream_timeout"
+	errCodeDownstreamUnavailable = "downstream_unavailable"
+	errCodeConcordance           = "concordance_error"
+	errCodeInternal              = "internal_error"
+)
+
+type notifyResponse struct {
+	UUID         string   `json:"uuid"`
+	TID          string   `json:"tid"`
+	Result       string   `json:"result"`
+	ID           string   `json:"id,omitempty"`
+	Terms        []term   `json:"terms"`
+	UnmappedTags []string `json:"unmappedTags"`
+	IgnoredTags  []string `json:"ignoredTags"`
+}
+
+type errorResponse struct {
+	TID       string `json:"tid"`
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	Retryable bool   `json:"retryable"`
+}
+
+func newNotifyResponse(uuid string, tid string, a annotations) notifyResponse {
+	resp := notifyResponse{UUID: uuid, TID: tid, Terms: a.Terms, UnmappedTags: a.Unmapped, IgnoredTags: a.Ignored}
+	if resp.Terms == nil {
+		resp.Terms = []term{}
+	}
+	if resp.UnmappedTags == nil {
+		resp.UnmappedTags = []string{}
+	}
+	if resp.IgnoredTags == nil {
+		resp.IgnoredTags = []string{}
+	}
+	return resp
+}
+
+func writeErrorResponse(w http.ResponseWriter, status int, resp errorResponse) {
+	warnLogger.Printf("tid=[%s]. %s", resp.TID, resp.Message)
+	writeJSON(w, status, resp)
+}
+
+func clientErr(w http.ResponseWriter, tid string, msg string) {
+	writeErrorResponse(w, http.StatusBadRequest, errorResponse{TID: tid, Code: errCodeInvalidRequest, Message: msg})
+}
+
+func notFoundErr(w http.ResponseWriter, tid string, msg string) {
+	writeErrorResponse(w, http.StatusNotFound, errorResponse{TID: tid, Code: errCodeNotFound, Message: msg})
+}
+
+func internalErr(w http.ResponseWriter, tid string, err error) {
+	writeErrorResponse(w, http.StatusInternalServerError, errorResponse{TID: tid, Code: errCodeInternal, Message: err.Error()})
+}
+
+// deliveryErr tells apart the failures of cms-metadata-notifier from the ones of this service
+func deliveryErr(w http.ResponseWriter, tid string, err error) {
+	de, ok := err.(*deliveryError)
+	if !ok {
+		internalErr(w, tid, err)
+		return
+	}
+	resp := errorResponse{TID: tid, Message: err.Error(), Retryable: de.retryable}
+	status := http.StatusBadGateway
+	switch {
+	case de.circuitOpen:
+		status, resp.Code, resp.Retryable = http.StatusServiceUnavailable, errCodeDownstreamUnavailable, true
+	case de.timeout:
+		status, resp.Code = http.StatusGatewayTimeout, errCodeDownstreamTimeout
+	case de.statusCode != 0 || de.retryable:
+		resp.Code = errCodeDownstreamError
+	default:
+		status, resp.Code = http.StatusInternalServerError, errCodeInternal
+	}
+	writeErrorResponse(w, status, resp)
+}
+
+// concordanceErr reports a failed concordance lookup, which only fails the notification when configured so
+func concordanceErr(w http.ResponseWriter, tid string, err error) {
+	writeErrorResponse(w, http.StatusBadGateway, errorResponse{TID: tid, Code: errCodeConcordance, Message: err.Error(), Retryable: true})
+}
+
+// publishErr reports a failure of publish
+func publishErr(w http.ResponseWriter, tid string, uuid string, err error) {
+	if cf, ok := err.(concordanceFailure); ok {
+		concordanceErr(w, tid, cf.error)
+		return
+	}
+	if err == errQueueFull {
+		queueFullErr(w, tid, uuid)
+		return
+	}
+	deliveryErr(w, tid, err)
+}
+
+func queueFullErr(w http.ResponseWriter, tid string, uuid string) {
+	writeErrorResponse(w, http.StatusTooManyRequests, errorResponse{
+		TID:       tid,
+		Code:      errCodeQueueFull,
+		Message:   fmt.Sprintf("%v. Rejected video=[%s]", errQueueFull, uuid),
+		Retryable: true,
+	})
+}
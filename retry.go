@@ -0,0 +1,60 @@
+package main
+
+import (
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// deliveryError describes a failed attempt to send metadata to cms-metadata-notifier
+type deliveryError struct {
+	msg         string
+	statusCode  int
+	body        string
+	retryable   bool
+	retryAfter  time.Duration
+	timeout     bool
+	circuitOpen bool
+	//deadLettered is set once the failed event has been written to the dead letter directory
+	deadLettered bool
+}
+
+func (e *deliveryError) Error() string {
+	return e.msg
+}
+
+// backoff returns the exponential delay before the given retry, with jitter spreading it over [delay/2, delay]
+func backoff(attempt int, initial time.Duration, max time.Duration) time.Duration {
+	delay := initial
+	for i := 1; i < attempt && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		delay = max
+	}
+	if delay <= 1 {
+		return delay
+	}
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(delay-half)+1))
+}
+
+// parseRetryAfter supports both the delay-seconds and the HTTP-date forms of the Retry-After header
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(value); err == nil {
+		if secs < 0 {
+			return 0
+		}
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		if d := t.Sub(time.Now()); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSendMetadata_TransientFailures_RetriedUntilSuccess(t *testing.T) {
+	attempts := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer ts.Close()
+	mm := metadataMapper{
+		config: &notifierConfig{
+			cmsMetadataNotifierAddr: ts.URL,
+			maxRetries:              3,
+			retryInitialBackoff:     time.Millisecond,
+			retryMaxBackoff:         time.Millisecond,
+		},
+		client: &http.Client{},
+	}
+
+	if err := mm.sendMetadata([]byte(""), "test_tid"); err != nil {
+		t.Errorf("Expected no error. Found: [%v]", err)
+	}
+	if attempts != 3 {
+		t.Errorf("Expected attempts: [3]. Actual: [%d]", attempts)
+	}
+}
+
+func TestSendMetadata_HugeRetryAfter_CappedAtMaxBackoff(t *testing.T) {
+	attempts := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts < 2 {
+			w.Header().Set("Retry-After", "86400")
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer ts.Close()
+	mm := metadataMapper{
+		config: &notifierConfig{
+			cmsMetadataNotifierAddr: ts.URL,
+			maxRetries:              1,
+			retryInitialBackoff:     time.Millisecond,
+			retryMaxBackoff:         10 * time.Millisecond,
+		},
+		client: &http.Client{},
+	}
+
+	start := time.Now()
+	if err := mm.sendMetadata([]byte(""), "test_tid"); err != nil {
+		t.Errorf("Expected no error. Found: [%v]", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expected the Retry-After to be capped at the max backoff. Waited: [%v]", elapsed)
+	}
+	if attempts != 2 {
+		t.Errorf("Expected attempts: [2]. Actual: [%d]", attempts)
+	}
+}
+
+func TestSendMetadata_ClientErrorStatusCode_NotRetried(t *testing.T) {
+	attempts := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer ts.Close()
+	mm := metadataMapper{
+		config: &notifierConfig{
+			cmsMetadataNotifierAddr: ts.URL,
+			maxRetries:              3,
+			retryInitialBackoff:     time.Millisecond,
+			retryMaxBackoff:         time.Millisecond,
+		},
+		client: &http.Client{},
+	}
+
+	if err := mm.sendMetadata([]byte(""), "test_tid"); err == nil {
+		t.Error("Expected error.")
+	}
+	if attempts != 1 {
+		t.Errorf("Expected attempts: [1]. Actual: [%d]", attempts)
+	}
+}
+
+func TestBackoff_DelayWithinBounds(t *testing.T) {
+	var testCases = []struct {
+		attempt int
+		min     time.Duration
+		max     time.Duration
+	}{
+		{1, 50 * time.Millisecond, 100 * time.Millisecond},
+		{2, 100 * time.Millisecond, 200 * time.Millisecond},
+		{3, 200 * time.Millisecond, 400 * time.Millisecond},
+		{10, 500 * time.Millisecond, time.Second},
+	}
+
+	for _, tc := range testCases {
+		actual := backoff(tc.attempt, 100*time.Millisecond, time.Second)
+		if actual < tc.min || actual > tc.max {
+			t.Errorf("Expected delay in [%v, %v]. Actual: [%v]. Testcase: [%+v]", tc.min, tc.max, actual, tc)
+		}
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	var testCases = []struct {
+		value    string
+		expected time.Duration
+	}{
+		{"", 0},
+		{"3", 3 * time.Second},
+		{"-1", 0},
+		{"not a delay", 0},
+		{"Wed, 21 Oct 2015 07:28:00 GMT", 0},
+	}
+
+	for _, tc := range testCases {
+		if actual := parseRetryAfter(tc.value); actual != tc.expected {
+			t.Errorf("Expected: [%v]. Actual: [%v]. Testcase: [%s]", tc.expected, actual, tc.value)
+		}
+	}
+}
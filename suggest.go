@@ -0,0 +1,196 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+type suggestion struct {
+	Key           string  `json:"key"`
+	CanonicalName string  `json:"canonicalName"`
+	ID            string  `json:"id"`
+	Score         float64 `json:"score"`
+}
+
+// suggestMappings returns up to limit mapping keys closest to the tag, best first, scoring at least minScore
+func suggestMappings(mappings map[string]term, tag string, limit int, minScore float64) []suggestion {
+	if limit <= 0 {
+		return nil
+	}
+	key := tagKey(tag)
+	var candidates []suggestion
+	for k, t := range mappings {
+		score := similarity(key, k)
+		if score < minScore {
+			continue
+		}
+		candidates = append(candidates, suggestion{Key: k, CanonicalName: t.CanonicalName, ID: t.ID, Score: score})
+	}
+	sort.Sort(byScore(candidates))
+	if len(candidates) > limit {
+		candidates = candidates[:limit]
+	}
+	return candidates
+}
+
+type byScore []suggestion
+
+func (s byScore) Len() int      { return len(s) }
+func (s byScore) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byScore) Less(i, j int) bool {
+	if s[i].Score != s[j].Score {
+		return s[i].Score > s[j].Score
+	}
+	return s[i].Key < s[j].Key
+}
+
+// similarity scores two keys in [0, 1], taking the better of the edit distance and the overlap of their words
+func similarity(a string, b string) float64 {
+	editScore := 1.0
+	if longest := maxInt(len([]rune(a)), len([]rune(b))); longest > 0 {
+		editScore = 1 - float64(levenshtein(a, b))/float64(longest)
+	}
+	tokenScore := jaccard(tokens(a), tokens(b))
+	if tokenScore > editScore {
+		return tokenScore
+	}
+	return editScore
+}
+
+func levenshtein(a string, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = minInt(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
+
+// tokens splits a key into words, dropping a plural "s" so that "market" and "markets" match
+func tokens(s string) map[string]bool {
+	words := strings.FieldsFunc(s, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) })
+	set := make(map[string]bool, len(words))
+	for _, w := range words {
+		if len(w) > 3 && strings.HasSuffix(w, "s") && !strings.HasSuffix(w, "ss") {
+			w = strings.TrimSuffix(w, "s")
+		}
+		set[w] = true
+	}
+	return set
+}
+
+func jaccard(a map[string]bool, b map[string]bool) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	common := 0
+	for w := range a {
+		if b[w] {
+			common++
+		}
+	}
+	return float64(common) / float64(len(a)+len(b)-common)
+}
+
+func minInt(values ...int) int {
+	m := values[0]
+	for _, v := range values[1:] {
+		if v < m {
+			m = v
+		}
+	}
+	return m
+}
+
+func maxInt(a int, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// suggestionCache holds the suggestions computed against one mappings version, so /__unmapped only scores the tags it didn't see yet
+type suggestionCache struct {
+	sync.Mutex
+	version string
+	byTag   map[string][]suggestion
+}
+
+// cached returns the suggestions already computed for the tags against the mappings version, and the tags still to score
+func (c *suggestionCache) cached(version string, tags []string) (map[string][]suggestion, []string) {
+	c.Lock()
+	defer c.Unlock()
+	found := make(map[string][]suggestion)
+	var missing []string
+	for _, tag := range tags {
+		s, ok := c.byTag[tag]
+		if !ok || c.version != version {
+			missing = append(missing, tag)
+			continue
+		}
+		found[tag] = s
+	}
+	return found, missing
+}
+
+// store keeps the suggestions of the tags only, so the tags evicted from the unmapped store don't pile up
+func (c *suggestionCache) store(version string, suggested map[string][]suggestion) {
+	c.Lock()
+	defer c.Unlock()
+	c.version, c.byTag = version, suggested
+}
+
+// suggestions returns the closest mappings for each of the tags, as configured.
+// The scoring runs outside the mapper lock, against the mappings being served when it starts: reloads swap the map rather than change it.
+func (mm *metadataMapper) suggestions(tags []string) map[string][]suggestion {
+	if mm.config == nil || mm.config.suggestionsCount <= 0 {
+		return make(map[string][]suggestion)
+	}
+	mm.RLock()
+	mappings, version := mm.mappings, mm.mappingVersion
+	mm.RUnlock()
+
+	found, missing := mm.suggested.cached(version, tags)
+	for _, tag := range missing {
+		found[tag] = suggestMappings(mappings, tag, mm.config.suggestionsCount, mm.config.suggestionMinScore)
+	}
+	mm.suggested.store(version, found)
+
+	suggested := make(map[string][]suggestion)
+	for tag, s := range found {
+		if len(s) > 0 {
+			suggested[tag] = s
+		}
+	}
+	return suggested
+}
+
+// autoApplied returns the best suggestion for the tag when auto-applying is enabled and it's above the strict threshold; must be called with the read lock held
+func (mm *metadataMapper) autoApplied(tag string) (term, string, bool) {
+	if mm.config == nil || !mm.config.autoApplySuggestions {
+		return term{}, "", false
+	}
+	best := suggestMappings(mm.mappings, tag, 1, mm.config.autoApplyMinScore)
+	if len(best) == 0 {
+		return term{}, "", false
+	}
+	suggested := mm.mappings[best[0].Key]
+	if !consistent(parseTag(tag), suggested, mm.config.namespaceTaxonomies) {
+		return term{}, "", false
+	}
+	return suggested, best[0].Key, true
+}
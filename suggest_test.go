@@ -0,0 +1,87 @@
+package main
+
+import "testing"
+
+var suggestionMappings = map[string]term{
+	"emerging-markets": term{CanonicalName: "Emerging-Markets", ID: "MTA2-U2VjdGlvbnM="},
+	"commodities":      term{CanonicalName: "Commodities", ID: "MTA1-U2VjdGlvbnM="},
+	"section:world":    term{CanonicalName: "section:world", ID: "MQ==-U2VjdGlvbnM="},
+}
+
+func TestSuggestMappings_TyposAndVariants_ClosestMappingFirst(t *testing.T) {
+	var testCases = []struct {
+		tag      string
+		expected string
+	}{
+		{"emerging market", "emerging-markets"},
+		{"Comodities", "commodities"},
+		{"section:wrld", "section:world"},
+	}
+
+	for _, tc := range testCases {
+		s := suggestMappings(suggestionMappings, tc.tag, 3, 0.6)
+		if len(s) == 0 || s[0].Key != tc.expected {
+			t.Errorf("Expected first suggestion: [%s]. Actual: [%+v]", tc.expected, s)
+		}
+	}
+}
+
+func TestSuggestMappings_UnrelatedTag_NoSuggestion(t *testing.T) {
+	if s := suggestMappings(suggestionMappings, "player:autoplay", 3, 0.6); len(s) != 0 {
+		t.Errorf("Expected no suggestion. Actual: [%+v]", s)
+	}
+}
+
+func TestAnnotate_AutoApplySuggestions_OnlyAboveThreshold(t *testing.T) {
+	mm := metadataMapper{
+		mappings: suggestionMappings,
+		config:   &notifierConfig{autoApplySuggestions: true, autoApplyMinScore: 0.95},
+	}
+
+	a := mm.annotate(video{UUID: "1234", Tags: []string{"emerging market", "Comodities"}}, "unit-test")
+
+	if len(a.Terms) != 1 || a.Terms[0].ID != "MTA2-U2VjdGlvbnM=" || a.Terms[0].Provenance.Rule != ruleSuggestion {
+		t.Errorf("Expected [emerging market] mapped through a suggestion. Actual: [%+v]", a.Terms)
+	}
+	if len(a.Unmapped) != 1 || a.Unmapped[0] != "Comodities" {
+		t.Errorf("Expected [Comodities] left unmapped. Actual: [%v]", a.Unmapped)
+	}
+}
+
+func TestSuggestions_CachedPerMappingVersion(t *testing.T) {
+	mm := metadataMapper{
+		mappings:       suggestionMappings,
+		mappingVersion: "v1",
+		config:         &notifierConfig{suggestionsCount: 3, suggestionMinScore: 0.6},
+	}
+	if s := mm.suggestions([]string{"Comodities"}); len(s["Comodities"]) == 0 {
+		t.Fatalf("Expected a suggestion for [Comodities]. Actual: [%+v]", s)
+	}
+
+	mm.mappings = map[string]term{}
+	if s := mm.suggestions([]string{"Comodities"}); len(s["Comodities"]) == 0 {
+		t.Errorf("Expected the suggestion cached for the same mappings version. Actual: [%+v]", s)
+	}
+
+	mm.mappingVersion = "v2"
+	if s := mm.suggestions([]string{"Comodities"}); len(s) != 0 {
+		t.Errorf("Expected the suggestions computed again for a new mappings version. Actual: [%+v]", s)
+	}
+}
+
+func TestLevenshtein(t *testing.T) {
+	var testCases = []struct {
+		a, b     string
+		expected int
+	}{
+		{"", "abc", 3},
+		{"kitten", "sitting", 3},
+		{"brazil", "brazil", 0},
+	}
+
+	for _, tc := range testCases {
+		if actual := levenshtein(tc.a, tc.b); actual != tc.expected {
+			t.Errorf("Expected: [%d]. Actual: [%d]. Testcase: [%+v]", tc.expected, actual, tc)
+		}
+	}
+}
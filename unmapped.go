@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// number of example videos kept for each unmapped tag
+const maxUnmappedExamples = 5
+
+type unmappedTag struct {
+	Tag         string       `json:"tag"`
+	Count       int          `json:"count"`
+	FirstSeen   time.Time    `json:"firstSeen"`
+	LastSeen    time.Time    `json:"lastSeen"`
+	Examples    []string     `json:"exampleUUIDs"`
+	Suggestions []suggestion `json:"suggestions,omitempty"`
+}
+
+// unmappedTagStore counts the tags without mapping; once full, the least recently seen tag makes room for a new one
+type unmappedTagStore struct {
+	sync.Mutex
+	limit int
+	tags  map[string]*unmappedTag
+	now   func() time.Time
+}
+
+func newUnmappedTagStore(limit int) *unmappedTagStore {
+	return &unmappedTagStore{limit: limit, tags: make(map[string]*unmappedTag), now: time.Now}
+}
+
+func (s *unmappedTagStore) record(uuid string, tags []string) {
+	s.Lock()
+	defer s.Unlock()
+	now := s.now().UTC()
+	for _, tag := range tags {
+		key := strings.ToLower(tag)
+		ut, present := s.tags[key]
+		if !present {
+			if len(s.tags) >= s.limit {
+				s.evict()
+			}
+			ut = &unmappedTag{Tag: tag, FirstSeen: now}
+			s.tags[key] = ut
+		}
+		ut.Count++
+		ut.LastSeen = now
+		if len(ut.Examples) < maxUnmappedExamples && !contains(ut.Examples, uuid) {
+			ut.Examples = append(ut.Examples, uuid)
+		}
+	}
+}
+
+func (s *unmappedTagStore) evict() {
+	var oldest string
+	for key, ut := range s.tags {
+		if oldest == "" || ut.LastSeen.Before(s.tags[oldest].LastSeen) {
+			oldest = key
+		}
+	}
+	delete(s.tags, oldest)
+}
+
+// list returns the unmapped tags, most frequent first
+func (s *unmappedTagStore) list() []unmappedTag {
+	s.Lock()
+	defer s.Unlock()
+	uts := make([]unmappedTag, 0, len(s.tags))
+	for _, ut := range s.tags {
+		c := *ut
+		c.Examples = append([]string(nil), ut.Examples...)
+		uts = append(uts, c)
+	}
+	sort.Sort(byFrequency(uts))
+	return uts
+}
+
+type byFrequency []unmappedTag
+
+func (u byFrequency) Len() int      { return len(u) }
+func (u byFrequency) Swap(i, j int) { u[i], u[j] = u[j], u[i] }
+func (u byFrequency) Less(i, j int) bool {
+	if u[i].Count != u[j].Count {
+		return u[i].Count > u[j].Count
+	}
+	return u[i].Tag < u[j].Tag
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func (mm *metadataMapper) recordUnmapped(uuid string, tags []string) {
+	if mm.unmapped == nil || len(tags) == 0 {
+		return
+	}
+	mm.unmapped.record(uuid, tags)
+}
+
+func (mm *metadataMapper) handleUnmapped(w http.ResponseWriter, r *http.Request) {
+	uts := mm.unmapped.list()
+	tags := make([]string, len(uts))
+	for i, ut := range uts {
+		tags[i] = ut.Tag
+	}
+	suggested := mm.suggestions(tags)
+	for i := range uts {
+		uts[i].Suggestions = suggested[uts[i].Tag]
+	}
+	if r.URL.Query().Get("format") != "csv" {
+		writeJSON(w, http.StatusOK, uts)
+		return
+	}
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", `attachment; filename="unmapped-tags.csv"`)
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"tag", "count", "firstSeen", "lastSeen", "exampleUUIDs", "suggestions"})
+	for _, ut := range uts {
+		var suggestions []string
+		for _, s := range ut.Suggestions {
+			suggestions = append(suggestions, fmt.Sprintf("%s (%.2f)", s.Key, s.Score))
+		}
+		cw.Write([]string{ut.Tag, strconv.Itoa(ut.Count), ut.FirstSeen.Format(time.RFC3339), ut.LastSeen.Format(time.RFC3339), strings.Join(ut.Examples, " "), strings.Join(suggestions, "; ")})
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		warnLogger.Printf("Writing unmapped tags CSV: [%v]", err)
+	}
+}
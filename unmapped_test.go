@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/csv"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestUnmappedTagStore_CountsExamplesAndOrder(t *testing.T) {
+	s := newUnmappedTagStore(10)
+	s.record("uuid_1", []string{"Brexit", "ft:noads"})
+	s.record("uuid_2", []string{"brexit"})
+	s.record("uuid_2", []string{"BREXIT"})
+
+	uts := s.list()
+	if len(uts) != 2 {
+		t.Fatalf("Expected unmapped tags: [2]. Actual: [%d]", len(uts))
+	}
+	if uts[0].Tag != "Brexit" || uts[0].Count != 3 {
+		t.Errorf("Expected [Brexit] counted 3 times first. Actual: [%+v]", uts[0])
+	}
+	if len(uts[0].Examples) != 2 {
+		t.Errorf("Expected distinct example UUIDs: [2]. Actual: [%v]", uts[0].Examples)
+	}
+}
+
+func TestUnmappedTagStore_LimitReached_LeastRecentlySeenEvicted(t *testing.T) {
+	now := time.Now()
+	s := newUnmappedTagStore(2)
+	s.now = func() time.Time { return now }
+	s.record("uuid_1", []string{"old"})
+	now = now.Add(time.Minute)
+	s.record("uuid_1", []string{"recent"})
+	now = now.Add(time.Minute)
+	s.record("uuid_1", []string{"new"})
+
+	for _, ut := range s.list() {
+		if ut.Tag == "old" {
+			t.Errorf("Expected [old] to be evicted.")
+		}
+	}
+}
+
+func TestHandleUnmapped_CSVExport(t *testing.T) {
+	mm := metadataMapper{unmapped: newUnmappedTagStore(10)}
+	mm.recordUnmapped("uuid_1", []string{"brexit"})
+
+	req, _ := http.NewRequest("GET", "/__unmapped?format=csv", nil)
+	w := httptest.NewRecorder()
+	mm.handleUnmapped(w, req)
+
+	records, err := csv.NewReader(w.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("[%v]", err)
+	}
+	if len(records) != 2 || records[1][0] != "brexit" || records[1][1] != "1" || records[1][4] != "uuid_1" {
+		t.Errorf("Unexpected CSV: [%v]", records)
+	}
+}